@@ -199,7 +199,7 @@ async function getVideos() {
       throw new Error(`Failed to get videos. Error: ${data.error}`);
     }
 
-    const videos = await res.json();
+    const { videos } = await res.json();
     const videoList = document.getElementById('video-list');
     videoList.innerHTML = '';
     for (const video of videos) {
@@ -299,3 +299,51 @@ async function deleteVideo() {
     alert(`Error: ${error.message}`);
   }
 }
+
+// Playback analytics beacons. Each time a video starts playing we open a new
+// session; progress is reported periodically while it plays.
+const progressBeaconInterval = 15; // seconds of playback between beacons
+let playbackSessionID = null;
+let lastProgressBeacon = 0;
+
+function sendPlaybackEvent(type, position) {
+  if (!currentVideo || !playbackSessionID) {
+    return;
+  }
+  fetch(`/api/videos/${currentVideo.id}/events`, {
+    method: 'POST',
+    keepalive: true,
+    headers: {
+      Authorization: `Bearer ${localStorage.getItem('token')}`,
+      'Content-Type': 'application/json',
+    },
+    body: JSON.stringify({ type, session_id: playbackSessionID, position }),
+  }).catch(() => {});
+}
+
+const playbackPlayer = document.getElementById('video-player');
+if (playbackPlayer) {
+  playbackPlayer.addEventListener('play', () => {
+    if (!playbackSessionID || playbackPlayer.currentTime === 0) {
+      playbackSessionID = crypto.randomUUID();
+      lastProgressBeacon = playbackPlayer.currentTime;
+      sendPlaybackEvent('play', playbackPlayer.currentTime);
+    }
+  });
+  playbackPlayer.addEventListener('timeupdate', () => {
+    if (Math.abs(playbackPlayer.currentTime - lastProgressBeacon) >= progressBeaconInterval) {
+      lastProgressBeacon = playbackPlayer.currentTime;
+      sendPlaybackEvent('progress', playbackPlayer.currentTime);
+    }
+  });
+  playbackPlayer.addEventListener('pause', () => {
+    sendPlaybackEvent('progress', playbackPlayer.currentTime);
+  });
+  playbackPlayer.addEventListener('ended', () => {
+    sendPlaybackEvent('complete', playbackPlayer.currentTime);
+    playbackSessionID = null;
+  });
+  playbackPlayer.addEventListener('emptied', () => {
+    playbackSessionID = null;
+  });
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/venzy/learn-file-storage-s3-golang/internal/database"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/media"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/peaks"
+)
+
+// Size and colour of the waveform image audio-only uploads get as their
+// thumbnail
+const (
+	waveformSize   = "1280x720"
+	waveformColour = "0x3b82f6"
+	waveformPrefix = "waveforms/"
+)
+
+// transcodeAudio converts an audio upload to AAC in an M4A container ready
+// for streaming. Audio that's already AAC is copied rather than re-encoded.
+// Cover art and anything else that isn't audio is dropped.
+func (cfg *apiConfig) transcodeAudio(ctx context.Context, filePath string, duration float64, report func(media.Progress)) (string, error) {
+	streams, err := cfg.probeStreams(ctx, filePath)
+	if err != nil {
+		return "", err
+	}
+	codec := []string{"-c:a", "copy"}
+	hasAudio := false
+	for _, stream := range streams {
+		if stream.CodecType != "audio" {
+			continue
+		}
+		hasAudio = true
+		if stream.CodecName != "aac" {
+			codec = []string{"-c:a", "aac", "-b:a", "192k"}
+		}
+	}
+	if !hasAudio {
+		return "", fmt.Errorf("no audio streams found in %s", filePath)
+	}
+
+	outputFilePath := filePath + ".processing"
+	args := append([]string{"-v", "error", "-i", filePath, "-map", "0:a", "-vn", "-sn", "-dn"}, codec...)
+	args = append(args, "-movflags", "faststart", "-f", "mp4", "-y", outputFilePath)
+	err = cfg.ffmpegWithProgress(ctx, report, duration, args...)
+	if err != nil {
+		return "", err
+	}
+	return outputFilePath, nil
+}
+
+// generateWaveform draws the first audio track of an audio-only version as a
+// single waveform image.
+func (cfg *apiConfig) generateWaveform(ctx context.Context, version database.VideoVersion, mediaPath string) error {
+	waveformPath := mediaPath + ".waveform.png"
+	err := cfg.ffmpeg(ctx, "-v", "error",
+		"-i", mediaPath,
+		"-filter_complex", fmt.Sprintf("[0:a:0]aformat=channel_layouts=mono,showwavespic=s=%s:colors=%s", waveformSize, waveformColour),
+		"-frames:v", "1", "-y", waveformPath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(waveformPath)
+
+	waveformFile, err := os.Open(waveformPath)
+	if err != nil {
+		return err
+	}
+	defer waveformFile.Close()
+
+	_, err = cfg.storeVersionAsset(ctx, version, database.AssetWaveform, waveformFile, waveformPrefix, ".png", "image/png")
+	return err
+}
+
+// Peaks are taken from audio downmixed to mono at this rate, which is plenty
+// for drawing and keeps decoding cheap
+const peaksSampleRate = 8000
+
+// generatePeaks summarises the version's first audio track as peaks JSON.
+// Media without audio gets none.
+func (cfg *apiConfig) generatePeaks(ctx context.Context, version database.VideoVersion, mediaPath string) error {
+	streams, err := cfg.probeStreams(ctx, mediaPath)
+	if err != nil {
+		return err
+	}
+	hasAudio := false
+	for _, stream := range streams {
+		hasAudio = hasAudio || stream.CodecType == "audio"
+	}
+	if !hasAudio {
+		return nil
+	}
+
+	var bucketSizes []int
+	for _, buckets := range peaks.Resolutions {
+		bucketSizes = append(bucketSizes, peaks.SamplesPerBucket(*version.Duration, peaksSampleRate, buckets))
+	}
+	builder := peaks.NewBuilder(peaksSampleRate, bucketSizes...)
+
+	_, err = cfg.media.Run(ctx, media.Job{
+		Tool: media.FFmpeg,
+		Args: []string{"-v", "error",
+			"-i", mediaPath,
+			"-map", "0:a:0", "-ac", "1", "-ar", strconv.Itoa(peaksSampleRate),
+			"-c:a", "pcm_s16le", "-f", "s16le", "pipe:1"},
+		Stdout: builder,
+	})
+	if err != nil {
+		return err
+	}
+
+	data, err := json.Marshal(builder.Peaks())
+	if err != nil {
+		return err
+	}
+	_, err = cfg.storeVersionAsset(ctx, version, database.AssetPeaks, bytes.NewReader(data), "peaks/", ".json", "application/json")
+	return err
+}
+
+// syncWaveformThumbnail keeps the video's thumbnail in step with its active
+// version after activating one: audio versions show their waveform, and a
+// waveform left over from an earlier audio version is cleared. Thumbnails the
+// owner uploaded are left alone.
+func (cfg *apiConfig) syncWaveformThumbnail(video database.Video) (database.Video, error) {
+	var thumbnailURL *string
+	if video.ThumbnailURL != nil {
+		// Uploaded thumbnails are the ones served from our assets directory
+		if _, uploaded := cfg.assetPathFromURL(*video.ThumbnailURL); uploaded {
+			return video, nil
+		}
+		key, ok := cfg.storageKeyFromURL(*video.ThumbnailURL)
+		if !ok || !strings.HasPrefix(key, waveformPrefix) {
+			thumbnailURL = video.ThumbnailURL
+		}
+	}
+	if waveformURL, ok := video.Assets[database.AssetWaveform]; ok && video.MediaKind == database.MediaKindAudio {
+		thumbnailURL = &waveformURL
+	}
+	if thumbnailURL == video.ThumbnailURL ||
+		thumbnailURL != nil && video.ThumbnailURL != nil && *thumbnailURL == *video.ThumbnailURL {
+		return video, nil
+	}
+
+	video.ThumbnailURL = thumbnailURL
+	err := cfg.db.UpdateVideo(video)
+	if err != nil {
+		return database.Video{}, err
+	}
+	return cfg.db.GetVideo(video.ID)
+}
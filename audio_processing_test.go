@@ -0,0 +1,78 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/venzy/learn-file-storage-s3-golang/internal/media"
+)
+
+func TestTranscodeAudio(t *testing.T) {
+	tests := []struct {
+		name    string
+		streams []string
+		codec   []string
+		wantErr bool
+	}{
+		{
+			name:    "AAC is copied",
+			streams: []string{`"index":0,"codec_type":"audio","codec_name":"aac"`},
+			codec:   []string{"-c:a", "copy"},
+		},
+		{
+			name: "anything else is re-encoded",
+			streams: []string{
+				`"index":0,"codec_type":"video","codec_name":"mjpeg"`,
+				`"index":1,"codec_type":"audio","codec_name":"mp3"`,
+			},
+			codec: []string{"-c:a", "aac", "-b:a", "192k"},
+		},
+		{
+			name:    "no audio",
+			streams: []string{`"index":0,"codec_type":"video","codec_name":"h264"`},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, runner := fakeMediaConfig(func(job media.Job) ([]byte, []byte, error) {
+				if job.Tool == media.FFprobe {
+					return probeOutput(tt.streams...), nil, nil
+				}
+				return nil, nil, nil
+			})
+			var reported []media.Progress
+			output, err := cfg.transcodeAudio(context.Background(), "in.mp3", 90, func(p media.Progress) {
+				reported = append(reported, p)
+			})
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("transcodeAudio() succeeded; want an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("transcodeAudio() error: %v", err)
+			}
+			if output != "in.mp3.processing" {
+				t.Errorf("output = %q; want %q", output, "in.mp3.processing")
+			}
+
+			jobs := runner.Jobs()
+			if len(jobs) != 2 {
+				t.Fatalf("ran %d jobs; want a probe and a transcode", len(jobs))
+			}
+			transcode := jobs[1]
+			if !hasArgs(transcode.Args, tt.codec...) {
+				t.Errorf("transcode args %q don't include %q", transcode.Args, tt.codec)
+			}
+			if !hasArgs(transcode.Args, "-map", "0:a", "-vn") {
+				t.Errorf("transcode args %q don't drop cover art", transcode.Args)
+			}
+			if transcode.Progress == nil || transcode.Duration != 90 {
+				t.Errorf("transcode reports progress %v over %gs; want progress over 90s", transcode.Progress != nil, transcode.Duration)
+			}
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"path"
+	"strconv"
+	"sync"
+
+	"github.com/google/uuid"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/chapters"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/database"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/fileext"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/media"
+)
+
+// Proposed chapters are at least this many seconds long, and there are no
+// more than maxProposedChapters of them
+const (
+	minProposedChapterLength = 30
+	maxProposedChapters      = 20
+)
+
+// Re-muxing chapters into stored media is serialised, so when an owner edits
+// chapters twice in quick succession the last edit is the one that sticks
+var chapterEmbedLock sync.Mutex
+
+// detectChapters proposes chapters for a video from its scene changes.
+func (cfg *apiConfig) detectChapters(ctx context.Context, filePath string, duration float64, report func(media.Progress)) ([]chapters.Chapter, error) {
+	// showinfo logs each selected frame to stderr
+	output, err := cfg.media.Run(ctx, media.Job{
+		Tool: media.FFmpeg,
+		Args: []string{"-hide_banner", "-nostats",
+			"-i", filePath,
+			"-map", "0:v:0", "-vf", chapters.SceneFilter(),
+			"-an", "-f", "null", "-"},
+		Progress: report,
+		Duration: duration,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return chapters.Propose(chapters.ParseSceneTimes(output), duration, minProposedChapterLength, maxProposedChapters), nil
+}
+
+// embedChapters copies a processed file with the chapters added as MP4
+// chapter metadata, replacing any it already had.
+func (cfg *apiConfig) embedChapters(ctx context.Context, filePath string, videoChapters []chapters.Chapter, duration float64) (string, error) {
+	metadataFile, err := os.CreateTemp("", "tubely-chapters.txt")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(metadataFile.Name())
+	_, err = metadataFile.Write(chapters.FFMetadata(videoChapters, duration))
+	metadataFile.Close()
+	if err != nil {
+		return "", err
+	}
+
+	outputFilePath := filePath + ".chapters"
+	err = cfg.ffmpeg(ctx, "-v", "error",
+		"-i", filePath,
+		"-f", "ffmetadata", "-i", metadataFile.Name(),
+		"-map", "0", "-map_chapters", "1",
+		"-c", "copy",
+		"-movflags", "faststart",
+		"-f", "mp4", "-y", outputFilePath)
+	if err != nil {
+		return "", err
+	}
+	return outputFilePath, nil
+}
+
+// ownerChapters returns the video's chapters if the owner has set them.
+func ownerChapters(video database.Video) []chapters.Chapter {
+	owned := []chapters.Chapter{}
+	for _, chapter := range video.Chapters {
+		if chapter.Source != database.ChapterSourceOwner {
+			return []chapters.Chapter{}
+		}
+		owned = append(owned, chapters.Chapter{Start: chapter.Start, Title: chapter.Title})
+	}
+	return owned
+}
+
+// storeDetectedChapters renders a thumbnail for each proposed chapter and
+// saves them as the video's chapters, unless the owner has set their own in
+// the meantime.
+func (cfg *apiConfig) storeDetectedChapters(ctx context.Context, videoID uuid.UUID, mediaPath string, proposed []chapters.Chapter) error {
+	detected := []database.Chapter{}
+	for i, chapter := range proposed {
+		thumbnailPath := mediaPath + ".chapter" + strconv.Itoa(i) + ".jpg"
+		err := cfg.ffmpeg(ctx, "-v", "error",
+			"-ss", strconv.FormatFloat(chapter.Start, 'f', 3, 64),
+			"-i", mediaPath,
+			"-frames:v", "1", "-vf", "scale=320:-2",
+			"-y", thumbnailPath)
+		if err != nil {
+			cfg.deleteChapterThumbnails(ctx, detected)
+			return err
+		}
+
+		thumbnailURL, err := cfg.putChapterThumbnail(ctx, thumbnailPath)
+		os.Remove(thumbnailPath)
+		if err != nil {
+			cfg.deleteChapterThumbnails(ctx, detected)
+			return err
+		}
+		detected = append(detected, database.Chapter{Start: chapter.Start, Title: chapter.Title, ThumbnailURL: &thumbnailURL})
+	}
+
+	removed, ok, err := cfg.db.ReplaceDetectedChapters(videoID, detected)
+	if err != nil || !ok {
+		cfg.deleteChapterThumbnails(ctx, detected)
+		return err
+	}
+	cfg.deleteChapterThumbnails(ctx, removed)
+	return nil
+}
+
+func (cfg *apiConfig) putChapterThumbnail(ctx context.Context, thumbnailPath string) (string, error) {
+	thumbnailFile, err := os.Open(thumbnailPath)
+	if err != nil {
+		return "", err
+	}
+	defer thumbnailFile.Close()
+
+	key := randomStorageKey("chapters/", ".jpg")
+	err = cfg.putObject(ctx, key, thumbnailFile, "image/jpeg")
+	if err != nil {
+		return "", err
+	}
+	return cfg.storageURL(key), nil
+}
+
+func (cfg *apiConfig) deleteChapterThumbnails(ctx context.Context, removed []database.Chapter) {
+	for _, chapter := range removed {
+		if chapter.ThumbnailURL == nil {
+			continue
+		}
+		key, ok := cfg.storageKeyFromURL(*chapter.ThumbnailURL)
+		if !ok {
+			continue
+		}
+		err := cfg.deleteObject(ctx, key)
+		if err != nil {
+			log.Printf("Couldn't delete chapter thumbnail: %v", err)
+		}
+	}
+}
+
+// embedVideoChapters re-muxes the media of the video's active version with
+// its current chapters, after the owner has edited them. Only the chapter
+// metadata changes, so the streams are copied as they are.
+func (cfg *apiConfig) embedVideoChapters(ctx context.Context, videoID uuid.UUID) error {
+	chapterEmbedLock.Lock()
+	defer chapterEmbedLock.Unlock()
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		return err
+	}
+	if video.ActiveVersionID == nil || video.Duration == nil {
+		return nil
+	}
+	version, err := cfg.db.GetVideoVersion(videoID, *video.ActiveVersionID)
+	if err != nil {
+		return err
+	}
+
+	sourceFile, err := os.CreateTemp("", "tubely-chapters-source")
+	if err != nil {
+		return err
+	}
+	sourceFile.Close()
+	defer os.Remove(sourceFile.Name())
+	err = cfg.downloadObject(ctx, version.StorageKey, sourceFile.Name())
+	if err != nil {
+		return err
+	}
+
+	chapteredFilePath, err := cfg.embedChapters(ctx, sourceFile.Name(), ownerChapters(video), *video.Duration)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(chapteredFilePath)
+
+	chapteredFile, err := os.Open(chapteredFilePath)
+	if err != nil {
+		return err
+	}
+	defer chapteredFile.Close()
+	info, err := chapteredFile.Stat()
+	if err != nil {
+		return err
+	}
+
+	mediaType := processedMediaType
+	if version.MediaKind == database.MediaKindAudio {
+		mediaType = processedAudioMediaType
+	}
+	key := randomStorageKey(path.Dir(version.StorageKey)+"/", fileext.FromMediaType(mediaType))
+	err = cfg.putObject(ctx, key, chapteredFile, mediaType)
+	if err != nil {
+		return err
+	}
+
+	previousKey, err := cfg.db.ReplaceVideoVersionMedia(version.ID, key, info.Size(), cfg.storageURL(key))
+	if err != nil {
+		cfg.deleteObject(ctx, key)
+		return err
+	}
+	return cfg.deleteObject(ctx, previousKey)
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"slices"
+	"testing"
+
+	"github.com/venzy/learn-file-storage-s3-golang/internal/media"
+)
+
+func TestDetectChapters(t *testing.T) {
+	// showinfo's log of the frames that passed the scene filter
+	showinfo := []byte(`[Parsed_showinfo_1 @ 0x55d] n:   0 pts:  62976 pts_time:4.1      duration:512 fmt:yuv420p
+[Parsed_showinfo_1 @ 0x55d] n:   1 pts: 537600 pts_time:35       duration:512 fmt:yuv420p
+[Parsed_showinfo_1 @ 0x55d] n:   2 pts: 640000 pts_time:50       duration:512 fmt:yuv420p
+[Parsed_showinfo_1 @ 0x55d] n:   3 pts: 896000 pts_time:70       duration:512 fmt:yuv420p
+[Parsed_showinfo_1 @ 0x55d] n:   4 pts:1280000 pts_time:100      duration:512 fmt:yuv420p
+`)
+	cfg, runner := fakeMediaConfig(func(job media.Job) ([]byte, []byte, error) {
+		return nil, showinfo, nil
+	})
+
+	proposed, err := cfg.detectChapters(context.Background(), "video.mp4", 120, nil)
+	if err != nil {
+		t.Fatalf("detectChapters() error: %v", err)
+	}
+
+	starts := []float64{}
+	for _, chapter := range proposed {
+		starts = append(starts, chapter.Start)
+	}
+	// 4.1 and 50 are too soon after the chapter before, and 100 too near
+	// the end
+	if expected := []float64{0, 35, 70}; !slices.Equal(starts, expected) {
+		t.Errorf("chapter starts = %v; want %v", starts, expected)
+	}
+
+	jobs := runner.Jobs()
+	if len(jobs) != 1 || !hasArgs(jobs[0].Args, "-map", "0:v:0") || jobs[0].Duration != 120 {
+		t.Errorf("jobs = %+v; want one scene detection pass over the video", jobs)
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/auth"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/database"
+)
+
+// handlerPlaybackEvent receives playback beacons from players. It's designed
+// for navigator.sendBeacon, so it doesn't insist on a JSON Content-Type and
+// authentication is optional.
+func (cfg *apiConfig) handlerPlaybackEvent(w http.ResponseWriter, r *http.Request) {
+	const maxSessionIDLength = 64
+
+	type parameters struct {
+		Type      database.PlaybackEventType `json:"type"`
+		SessionID string                     `json:"session_id"`
+		Position  float64                    `json:"position"`
+	}
+
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	userID := uuid.Nil
+	token, err := auth.GetBearerToken(r.Header)
+	if err == nil {
+		userID, err = auth.ValidateJWT(token, cfg.jwtSecret)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+			return
+		}
+	}
+
+	decoder := json.NewDecoder(http.MaxBytesReader(w, r.Body, 4<<10))
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if !params.Type.Valid() {
+		respondWithError(w, http.StatusBadRequest, "Invalid event type", nil)
+		return
+	}
+	if params.SessionID == "" || len(params.SessionID) > maxSessionIDLength {
+		respondWithError(w, http.StatusBadRequest, "Invalid session ID", nil)
+		return
+	}
+	if params.Position < 0 {
+		respondWithError(w, http.StatusBadRequest, "Invalid position", nil)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil || video.VideoURL == nil || !video.CanBeViewedBy(userID) {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+
+	err = cfg.db.RecordPlaybackEvent(database.PlaybackEvent{
+		VideoID:   videoID,
+		SessionID: params.SessionID,
+		ViewerKey: viewerKey(r, userID),
+		Type:      params.Type,
+		Position:  params.Position,
+		Duration:  video.Duration,
+		At:        time.Now(),
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't record event", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// viewerKey identifies a viewer for unique counts: signed in users by ID, and
+// anonymous viewers by a hash of their address and user agent so we don't
+// store either.
+func viewerKey(r *http.Request, userID uuid.UUID) string {
+	if userID != uuid.Nil {
+		return "user:" + userID.String()
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	sum := sha256.Sum256([]byte(host + "|" + r.UserAgent()))
+	return "anon:" + hex.EncodeToString(sum[:16])
+}
+
+func (cfg *apiConfig) handlerVideoStats(w http.ResponseWriter, r *http.Request) {
+	const dayFormat = "2006-01-02"
+	const defaultDays = 30
+	const maxDays = 366
+
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't view stats for this video", nil)
+		return
+	}
+
+	query := r.URL.Query()
+	to := time.Now().UTC()
+	if toString := query.Get("to"); toString != "" {
+		to, err = time.Parse(dayFormat, toString)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "to must be a date (YYYY-MM-DD)", err)
+			return
+		}
+	}
+	from := to.AddDate(0, 0, -(defaultDays - 1))
+	if fromString := query.Get("from"); fromString != "" {
+		from, err = time.Parse(dayFormat, fromString)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "from must be a date (YYYY-MM-DD)", err)
+			return
+		}
+	}
+	if from.After(to) || to.Sub(from) > maxDays*24*time.Hour {
+		respondWithError(w, http.StatusBadRequest, "Invalid date range", nil)
+		return
+	}
+
+	stats, err := cfg.db.GetVideoStats(videoID, from, to)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video stats", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, stats)
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/venzy/learn-file-storage-s3-golang/internal/captions"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/database"
+)
+
+// A BCP 47 style tag, e.g. "en" or "pt-BR"
+var captionLanguagePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+// handlerCaptionTrackPut accepts an SRT or WebVTT file in the "captions"
+// form field, stores it as WebVTT, and replaces any existing track for the
+// language.
+func (cfg *apiConfig) handlerCaptionTrackPut(w http.ResponseWriter, r *http.Request) {
+	const maxCaptionSize = 2 << 20 // 2 MB
+	const maxLabelLength = 100
+
+	video, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	language := r.PathValue("language")
+	if !captionLanguagePattern.MatchString(language) {
+		respondWithError(w, http.StatusBadRequest, "Invalid language tag", nil)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxCaptionSize+(64<<10))
+	err := r.ParseMultipartForm(maxCaptionSize)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Unable to parse form", err)
+		return
+	}
+
+	uploadFile, _, err := r.FormFile("captions")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Unable to parse form file", err)
+		return
+	}
+	defer uploadFile.Close()
+
+	label := strings.TrimSpace(r.FormValue("label"))
+	if label == "" {
+		label = language
+	}
+	if len(label) > maxLabelLength {
+		respondWithError(w, http.StatusBadRequest, "Label is too long", nil)
+		return
+	}
+
+	data, err := io.ReadAll(io.LimitReader(uploadFile, maxCaptionSize+1))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to read file", err)
+		return
+	}
+	if len(data) > maxCaptionSize {
+		respondWithError(w, http.StatusBadRequest, "File too large", nil)
+		return
+	}
+
+	vtt, err := captions.ToWebVTT(data)
+	if errors.Is(err, captions.ErrNoCues) {
+		respondWithError(w, http.StatusBadRequest, "Captions file has no cues", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Captions must be valid SRT or WebVTT: "+err.Error(), err)
+		return
+	}
+
+	previous, err := cfg.db.GetCaptionTrack(video.ID, language)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get caption track", err)
+		return
+	}
+
+	key := randomStorageKey("captions/", ".vtt")
+	err = cfg.putObject(r.Context(), key, bytes.NewReader(vtt), "text/vtt")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to upload captions", err)
+		return
+	}
+
+	err = cfg.db.SetCaptionTrack(video.ID, database.CaptionTrack{
+		Language: language,
+		Label:    label,
+		URL:      cfg.storageURL(key),
+		Source:   database.CaptionSourceUpload,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save caption track", err)
+		return
+	}
+	cfg.deleteCaptionBlob(r.Context(), previous)
+
+	video, err = cfg.db.GetVideo(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, video)
+}
+
+func (cfg *apiConfig) handlerCaptionTrackDelete(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	language := r.PathValue("language")
+	track, err := cfg.db.GetCaptionTrack(video.ID, language)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get caption track", err)
+		return
+	}
+	// Without one of the owner's tracks, delete the one extracted from the
+	// active version
+	if track.URL == "" && video.ActiveVersionID != nil {
+		track, err = cfg.db.GetVersionCaptionTrack(*video.ActiveVersionID, language)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get caption track", err)
+			return
+		}
+	}
+	if track.URL == "" {
+		respondWithError(w, http.StatusNotFound, "Caption track not found", nil)
+		return
+	}
+
+	if track.Source == database.CaptionSourceEmbedded {
+		err = cfg.db.DeleteVersionCaptionTrack(*video.ActiveVersionID, track.Language)
+	} else {
+		err = cfg.db.DeleteCaptionTrack(video.ID, track.Language)
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete caption track", err)
+		return
+	}
+	cfg.deleteCaptionBlob(r.Context(), track)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// deleteCaptionBlob removes a caption track's file once nothing refers to it.
+// Failing to is only logged: the track itself is already gone.
+func (cfg *apiConfig) deleteCaptionBlob(ctx context.Context, track database.CaptionTrack) {
+	key, ok := cfg.storageKeyFromURL(track.URL)
+	if !ok {
+		return
+	}
+	err := cfg.deleteObject(ctx, key)
+	if err != nil {
+		log.Printf("Couldn't delete caption file: %v", err)
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/auth"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/chapters"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/database"
+)
+
+// handlerChaptersPut replaces a video's chapters with the owner's own. A
+// chapter whose start time hasn't changed keeps its thumbnail. The chapters
+// are re-muxed into the stored media in the background.
+func (cfg *apiConfig) handlerChaptersPut(w http.ResponseWriter, r *http.Request) {
+	const maxChapters = 100
+	const maxTitleLength = 200
+
+	type chapter struct {
+		Start *float64 `json:"start"`
+		Title string   `json:"title"`
+	}
+	type parameters struct {
+		Chapters []chapter `json:"chapters"`
+	}
+
+	video, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if len(params.Chapters) > maxChapters {
+		respondWithError(w, http.StatusBadRequest, "Too many chapters", nil)
+		return
+	}
+
+	thumbnails := map[float64]*string{}
+	for _, existing := range video.Chapters {
+		thumbnails[existing.Start] = existing.ThumbnailURL
+	}
+
+	updated := []database.Chapter{}
+	starts := map[float64]bool{}
+	for _, c := range params.Chapters {
+		title := strings.TrimSpace(c.Title)
+		if title == "" || utf8.RuneCountInString(title) > maxTitleLength {
+			respondWithError(w, http.StatusBadRequest, "Each chapter needs a title of up to 200 characters", nil)
+			return
+		}
+		if c.Start == nil || *c.Start < 0 || (video.Duration != nil && *c.Start >= *video.Duration) {
+			respondWithError(w, http.StatusBadRequest, "Each chapter needs a start time within the video", nil)
+			return
+		}
+		if starts[*c.Start] {
+			respondWithError(w, http.StatusBadRequest, "Chapters must start at different times", nil)
+			return
+		}
+		starts[*c.Start] = true
+		updated = append(updated, database.Chapter{Start: *c.Start, Title: title, ThumbnailURL: thumbnails[*c.Start]})
+	}
+	sort.Slice(updated, func(i, j int) bool { return updated[i].Start < updated[j].Start })
+
+	removed, err := cfg.db.SetChapters(video.ID, updated)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save chapters", err)
+		return
+	}
+	unused := []database.Chapter{}
+	for _, old := range removed {
+		if !starts[old.Start] {
+			unused = append(unused, old)
+		}
+	}
+	cfg.deleteChapterThumbnails(r.Context(), unused)
+
+	if video.ActiveVersionID != nil {
+		go func() {
+			err := cfg.embedVideoChapters(context.Background(), video.ID)
+			if err != nil {
+				log.Printf("Couldn't embed chapters for video %s: %v", video.ID, err)
+			}
+		}()
+	}
+
+	video, err = cfg.db.GetVideo(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, video.Chapters)
+}
+
+// handlerChaptersWebVTT serves a video's chapters as a WebVTT chapters
+// track, for players' chapter menus.
+func (cfg *apiConfig) handlerChaptersWebVTT(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	// Authentication is optional, but needed for private videos
+	userID := uuid.Nil
+	token, err := auth.GetBearerToken(r.Header)
+	if err == nil {
+		userID, err = auth.ValidateJWT(token, cfg.jwtSecret)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+			return
+		}
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil || !video.CanBeViewedBy(userID) {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+	if len(video.Chapters) == 0 || video.Duration == nil {
+		respondWithError(w, http.StatusNotFound, "Video has no chapters", nil)
+		return
+	}
+
+	videoChapters := []chapters.Chapter{}
+	for _, chapter := range video.Chapters {
+		videoChapters = append(videoChapters, chapters.Chapter{Start: chapter.Start, Title: chapter.Title})
+	}
+
+	w.Header().Set("Content-Type", "text/vtt; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	w.Write(chapters.WebVTT(videoChapters, *video.Duration))
+}
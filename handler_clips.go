@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/auth"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/database"
+)
+
+// How close to a keyframe a clip has to start to be cut without re-encoding
+const keyframeTolerance = 0.04
+
+const minClipLength = 0.5
+
+// handlerClipCreate cuts start..end (in seconds) out of a video the caller can
+// see into a new private video that they own. Cutting happens in the
+// background, so the new video is returned straight away with a status of
+// processing.
+func (cfg *apiConfig) handlerClipCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Start *float64 `json:"start"`
+		End   *float64 `json:"end"`
+		Title string   `json:"title"`
+	}
+
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	source, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if source.ID == uuid.Nil || !source.CanBeViewedBy(userID) {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+	if source.Status != database.VideoStatusReady || source.VideoURL == nil || source.Duration == nil {
+		respondWithError(w, http.StatusConflict, "Video has no media to clip", nil)
+		return
+	}
+	sourceKey, ok := cfg.storageKeyFromURL(*source.VideoURL)
+	if !ok || source.MediaKind != database.MediaKindVideo {
+		respondWithError(w, http.StatusConflict, "Video's media can't be clipped", nil)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.Start == nil || params.End == nil {
+		respondWithError(w, http.StatusBadRequest, "start and end are required", nil)
+		return
+	}
+	start, end := *params.Start, *params.End
+	if start < 0 || end > *source.Duration || end-start < minClipLength {
+		respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Clip must be at least %g seconds long and within the video", minClipLength), nil)
+		return
+	}
+	title := strings.TrimSpace(params.Title)
+	if title == "" {
+		title = "Clip of " + source.Title
+	}
+
+	clip, err := cfg.db.CreateVideo(database.CreateVideoParams{
+		Title:      title,
+		Visibility: database.VisibilityPrivate,
+		UserID:     userID,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create clip", err)
+		return
+	}
+	err = cfg.db.SetVideoStatus(clip.ID, database.VideoStatusProcessing)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update clip", err)
+		return
+	}
+	clip.Status = database.VideoStatusProcessing
+
+	// The request's context ends with the response, so the background work
+	// gets its own
+	go cfg.processClip(context.Background(), clip, sourceKey, start, end, userID)
+
+	respondWithJSON(w, http.StatusAccepted, clip)
+}
+
+// processClip cuts the clip from the source media and runs the result
+// through the usual processing pipeline, recording progress on a single
+// processing job throughout.
+func (cfg *apiConfig) processClip(ctx context.Context, clip database.Video, sourceKey string, start, end float64, userID uuid.UUID) {
+	job := cfg.startProcessingJob(clip.ID, stageCutting)
+	err := cfg.cutClip(ctx, job, clip, sourceKey, start, end, userID)
+	if err != nil {
+		log.Printf("Couldn't make clip %s: %v", clip.ID, err)
+		cfg.db.SetVideoStatus(clip.ID, database.VideoStatusFailed)
+		job.finish(false)
+	}
+}
+
+func (cfg *apiConfig) cutClip(ctx context.Context, job *processingJob, clip database.Video, sourceKey string, start, end float64, userID uuid.UUID) error {
+	sourceFile, err := os.CreateTemp("", "tubely-clip-source.mp4")
+	if err != nil {
+		return err
+	}
+	sourceFile.Close()
+	defer os.Remove(sourceFile.Name())
+
+	err = cfg.downloadObject(ctx, sourceKey, sourceFile.Name())
+	if err != nil {
+		return err
+	}
+
+	clipPath, err := cfg.cutMedia(ctx, job, sourceFile.Name(), start, end)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(clipPath)
+
+	_, err = cfg.processMedia(ctx, job, clip, clipPath, database.MediaKindVideo, userID, processingOptions{})
+	return err
+}
+
+// cutMedia copies the part of the media in filePath from start to end
+// seconds into a new file, returning its path.
+func (cfg *apiConfig) cutMedia(ctx context.Context, job *processingJob, filePath string, start, end float64) (string, error) {
+	aligned, err := cfg.isKeyframeAligned(ctx, filePath, start)
+	if err != nil {
+		return "", err
+	}
+
+	clipPath := filePath + ".clip"
+	args := []string{
+		"-v", "error",
+		"-ss", strconv.FormatFloat(start, 'f', 3, 64),
+		"-i", filePath,
+		"-t", strconv.FormatFloat(end-start, 'f', 3, 64),
+		"-map", "0:v:0", "-map", "0:a?",
+	}
+	if aligned {
+		// Copying is lossless and quick, but can only start on a keyframe
+		args = append(args, "-c", "copy", "-avoid_negative_ts", "make_zero")
+	} else {
+		args = append(args, "-c:v", "libx264", "-preset", "veryfast", "-crf", "20", "-c:a", "aac")
+	}
+	args = append(args, "-f", "mp4", "-y", clipPath)
+	err = cfg.ffmpegWithProgress(ctx, job.report, end-start, args...)
+	if err != nil {
+		return "", err
+	}
+	return clipPath, nil
+}
+
+// isKeyframeAligned reports whether the video in filePath has a keyframe at
+// (or very near) t seconds.
+func (cfg *apiConfig) isKeyframeAligned(ctx context.Context, filePath string, t float64) (bool, error) {
+	// Only look at the keyframes around t rather than scanning the whole file
+	interval := fmt.Sprintf("%.3f%%+2", max(0, t-1))
+	output, err := cfg.ffprobe(ctx, "-v", "error", "-select_streams", "v:0", "-skip_frame", "nokey", "-read_intervals", interval, "-show_entries", "frame=best_effort_timestamp_time", "-of", "csv=p=0", filePath)
+	if err != nil {
+		return false, err
+	}
+
+	for _, line := range strings.Fields(string(output)) {
+		keyframe, err := strconv.ParseFloat(strings.TrimSuffix(line, ","), 64)
+		if err != nil {
+			continue
+		}
+		if keyframe >= t-keyframeTolerance && keyframe <= t+keyframeTolerance {
+			return true, nil
+		}
+	}
+	return false, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/venzy/learn-file-storage-s3-golang/internal/media"
+)
+
+func TestCutMedia(t *testing.T) {
+	// Keyframes every two seconds
+	keyframes := []byte("8.000000\n10.000000\n12.000000\n")
+	tests := []struct {
+		name  string
+		start float64
+		codec []string
+	}{
+		{"on a keyframe it's copied", 10, []string{"-c", "copy", "-avoid_negative_ts", "make_zero"}},
+		{"between keyframes it's re-encoded", 11, []string{"-c:v", "libx264", "-preset", "veryfast", "-crf", "20", "-c:a", "aac"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, runner := fakeMediaConfig(func(job media.Job) ([]byte, []byte, error) {
+				if job.Tool == media.FFprobe {
+					return keyframes, nil, nil
+				}
+				return nil, nil, nil
+			})
+
+			clipPath, err := cfg.cutMedia(context.Background(), nil, "source.mp4", tt.start, tt.start+30)
+			if err != nil {
+				t.Fatalf("cutMedia() error: %v", err)
+			}
+			if clipPath != "source.mp4.clip" {
+				t.Errorf("clip path = %q; want %q", clipPath, "source.mp4.clip")
+			}
+
+			jobs := runner.Jobs()
+			if len(jobs) != 2 {
+				t.Fatalf("ran %d jobs; want a keyframe probe and a cut", len(jobs))
+			}
+			cut := jobs[1]
+			if !hasArgs(cut.Args, tt.codec...) {
+				t.Errorf("cut args %q don't include %q", cut.Args, tt.codec)
+			}
+			if !hasArgs(cut.Args, "-t", "30.000") {
+				t.Errorf("cut args %q don't cut 30 seconds", cut.Args)
+			}
+			if cut.Duration != 30 {
+				t.Errorf("cut reports progress over %gs; want 30s", cut.Duration)
+			}
+		})
+	}
+}
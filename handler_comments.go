@@ -0,0 +1,373 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/auth"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/database"
+)
+
+const maxCommentLength = 2000
+
+func validateCommentBody(body string) (string, error) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return "", errors.New("comment can't be empty")
+	}
+	if utf8.RuneCountInString(body) > maxCommentLength {
+		return "", fmt.Errorf("comment must be at most %d characters", maxCommentLength)
+	}
+	return body, nil
+}
+
+func (cfg *apiConfig) handlerCommentsRetrieve(w http.ResponseWriter, r *http.Request) {
+	const defaultLimit = 20
+	const maxLimit = 100
+
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	// Authentication is optional, but needed to see private videos' comments
+	userID := uuid.Nil
+	token, err := auth.GetBearerToken(r.Header)
+	if err == nil {
+		userID, err = auth.ValidateJWT(token, cfg.jwtSecret)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+			return
+		}
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil || !video.CanBeViewedBy(userID) {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+
+	params := database.GetCommentsParams{
+		VideoID:       videoID,
+		Limit:         defaultLimit,
+		Cursor:        r.URL.Query().Get("cursor"),
+		IncludeHidden: video.UserID == userID,
+	}
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		params.Limit, err = strconv.Atoi(limit)
+		if err != nil || params.Limit < 1 || params.Limit > maxLimit {
+			respondWithError(w, http.StatusBadRequest, "Invalid limit", err)
+			return
+		}
+	}
+
+	page, err := cfg.db.GetComments(params)
+	if errors.Is(err, database.ErrInvalidCursor) {
+		respondWithError(w, http.StatusBadRequest, "Invalid cursor", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve comments", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, page)
+}
+
+// handlerCommentRepliesRetrieve pages through the replies to a top level
+// comment beyond the first few that come with it.
+func (cfg *apiConfig) handlerCommentRepliesRetrieve(w http.ResponseWriter, r *http.Request) {
+	const defaultLimit = 20
+	const maxLimit = 100
+
+	commentIDString := r.PathValue("commentID")
+	commentID, err := uuid.Parse(commentIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid comment ID", err)
+		return
+	}
+
+	// Authentication is optional, but needed to see private videos' comments
+	userID := uuid.Nil
+	token, err := auth.GetBearerToken(r.Header)
+	if err == nil {
+		userID, err = auth.ValidateJWT(token, cfg.jwtSecret)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+			return
+		}
+	}
+
+	comment, err := cfg.db.GetComment(commentID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get comment", err)
+		return
+	}
+	if comment.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Comment not found", nil)
+		return
+	}
+	video, err := cfg.db.GetVideo(comment.VideoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil || !video.CanBeViewedBy(userID) || (comment.Hidden && video.UserID != userID) {
+		respondWithError(w, http.StatusNotFound, "Comment not found", nil)
+		return
+	}
+
+	params := database.GetRepliesParams{
+		ParentID:      comment.ID,
+		Limit:         defaultLimit,
+		Cursor:        r.URL.Query().Get("cursor"),
+		IncludeHidden: video.UserID == userID,
+	}
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		params.Limit, err = strconv.Atoi(limit)
+		if err != nil || params.Limit < 1 || params.Limit > maxLimit {
+			respondWithError(w, http.StatusBadRequest, "Invalid limit", err)
+			return
+		}
+	}
+
+	page, err := cfg.db.GetReplies(params)
+	if errors.Is(err, database.ErrInvalidCursor) {
+		respondWithError(w, http.StatusBadRequest, "Invalid cursor", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve replies", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, page)
+}
+
+func (cfg *apiConfig) handlerCommentCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Body     string     `json:"body"`
+		ParentID *uuid.UUID `json:"parent_id"`
+	}
+
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil || !video.CanBeViewedBy(userID) {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+	if !video.CommentsEnabled {
+		respondWithError(w, http.StatusForbidden, "Comments are disabled for this video", nil)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	body, err := validateCommentBody(params.Body)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	if params.ParentID != nil {
+		parent, err := cfg.db.GetComment(*params.ParentID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get parent comment", err)
+			return
+		}
+		if parent.ID == uuid.Nil || parent.VideoID != videoID || (parent.Hidden && video.UserID != userID) {
+			respondWithError(w, http.StatusNotFound, "Parent comment not found", nil)
+			return
+		}
+		if parent.ParentID != nil {
+			respondWithError(w, http.StatusBadRequest, "Replies can't be replied to", nil)
+			return
+		}
+	}
+
+	comment, err := cfg.db.CreateComment(database.CreateCommentParams{
+		VideoID:  videoID,
+		UserID:   userID,
+		ParentID: params.ParentID,
+		Body:     body,
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create comment", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, comment)
+}
+
+func (cfg *apiConfig) handlerCommentUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Body string `json:"body"`
+	}
+
+	comment, _, userID, ok := cfg.getCommentForUser(w, r)
+	if !ok {
+		return
+	}
+	if comment.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can only edit your own comments", nil)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	body, err := validateCommentBody(params.Body)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), nil)
+		return
+	}
+
+	err = cfg.db.UpdateCommentBody(comment.ID, body)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update comment", err)
+		return
+	}
+
+	comment, err = cfg.db.GetComment(comment.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get comment", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, comment)
+}
+
+// handlerCommentDelete lets authors delete their own comments, and video
+// owners delete any comment on their video.
+func (cfg *apiConfig) handlerCommentDelete(w http.ResponseWriter, r *http.Request) {
+	comment, video, userID, ok := cfg.getCommentForUser(w, r)
+	if !ok {
+		return
+	}
+	if comment.UserID != userID && video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't delete this comment", nil)
+		return
+	}
+
+	err := cfg.db.DeleteComment(comment.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete comment", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerCommentHide(w http.ResponseWriter, r *http.Request) {
+	cfg.setCommentHidden(w, r, true)
+}
+
+func (cfg *apiConfig) handlerCommentUnhide(w http.ResponseWriter, r *http.Request) {
+	cfg.setCommentHidden(w, r, false)
+}
+
+func (cfg *apiConfig) setCommentHidden(w http.ResponseWriter, r *http.Request, hidden bool) {
+	comment, video, userID, ok := cfg.getCommentForUser(w, r)
+	if !ok {
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "Only the video's owner can moderate comments", nil)
+		return
+	}
+
+	err := cfg.db.SetCommentHidden(comment.ID, hidden)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update comment", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getCommentForUser authenticates the request and loads the {commentID} it
+// targets along with its video, responding with an error and returning false
+// if either can't be found or the caller can't see them.
+func (cfg *apiConfig) getCommentForUser(w http.ResponseWriter, r *http.Request) (database.Comment, database.Video, uuid.UUID, bool) {
+	commentIDString := r.PathValue("commentID")
+	commentID, err := uuid.Parse(commentIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid comment ID", err)
+		return database.Comment{}, database.Video{}, uuid.Nil, false
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return database.Comment{}, database.Video{}, uuid.Nil, false
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return database.Comment{}, database.Video{}, uuid.Nil, false
+	}
+
+	comment, err := cfg.db.GetComment(commentID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get comment", err)
+		return database.Comment{}, database.Video{}, uuid.Nil, false
+	}
+	if comment.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Comment not found", nil)
+		return database.Comment{}, database.Video{}, uuid.Nil, false
+	}
+
+	video, err := cfg.db.GetVideo(comment.VideoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return database.Comment{}, database.Video{}, uuid.Nil, false
+	}
+	if video.ID == uuid.Nil || !video.CanBeViewedBy(userID) {
+		respondWithError(w, http.StatusNotFound, "Comment not found", nil)
+		return database.Comment{}, database.Video{}, uuid.Nil, false
+	}
+
+	return comment, video, userID, true
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/auth"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/database"
+)
+
+// handlerVideoPeaks redirects to the peaks JSON of the video's active
+// version, for drawing its waveform.
+func (cfg *apiConfig) handlerVideoPeaks(w http.ResponseWriter, r *http.Request) {
+	videoID, err := uuid.Parse(r.PathValue("videoID"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid video ID", err)
+		return
+	}
+
+	// Authentication is optional, but needed for private videos
+	userID := uuid.Nil
+	token, err := auth.GetBearerToken(r.Header)
+	if err == nil {
+		userID, err = auth.ValidateJWT(token, cfg.jwtSecret)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+			return
+		}
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil || !video.CanBeViewedBy(userID) {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+
+	peaksURL, ok := video.Assets[database.AssetPeaks]
+	if !ok {
+		respondWithError(w, http.StatusNotFound, "Video has no peaks", nil)
+		return
+	}
+
+	http.Redirect(w, r, peaksURL, http.StatusFound)
+}
@@ -0,0 +1,339 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/auth"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/database"
+)
+
+func (cfg *apiConfig) handlerPlaylistCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		database.CreatePlaylistParams
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	params.UserID = userID
+	if params.Title == "" {
+		respondWithError(w, http.StatusBadRequest, "Title is required", nil)
+		return
+	}
+	if params.Visibility != "" && !params.Visibility.Valid() {
+		respondWithError(w, http.StatusBadRequest, "Invalid visibility", nil)
+		return
+	}
+
+	playlist, err := cfg.db.CreatePlaylist(params.CreatePlaylistParams)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create playlist", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, playlist)
+}
+
+func (cfg *apiConfig) handlerPlaylistsRetrieve(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	playlists, err := cfg.db.GetPlaylists(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve playlists", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, playlists)
+}
+
+func (cfg *apiConfig) handlerPlaylistGet(w http.ResponseWriter, r *http.Request) {
+	playlistIDString := r.PathValue("playlistID")
+	playlistID, err := uuid.Parse(playlistIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid playlist ID", err)
+		return
+	}
+
+	// Authentication is optional, but needed to see private playlists
+	userID := uuid.Nil
+	token, err := auth.GetBearerToken(r.Header)
+	if err == nil {
+		userID, err = auth.ValidateJWT(token, cfg.jwtSecret)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+			return
+		}
+	}
+
+	playlist, err := cfg.db.GetPlaylist(playlistID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get playlist", err)
+		return
+	}
+	if playlist.ID == uuid.Nil || !playlist.CanBeViewedBy(userID) {
+		respondWithError(w, http.StatusNotFound, "Playlist not found", nil)
+		return
+	}
+
+	items, err := cfg.db.GetPlaylistItems(playlistID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get playlist items", err)
+		return
+	}
+
+	// A public playlist doesn't make the private videos in it public
+	playlist.Items = make([]database.PlaylistItem, 0, len(items))
+	for _, item := range items {
+		if item.Video.CanBeViewedBy(userID) {
+			playlist.Items = append(playlist.Items, item)
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, playlist)
+}
+
+func (cfg *apiConfig) handlerPlaylistUpdate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Title       *string              `json:"title"`
+		Description *string              `json:"description"`
+		Visibility  *database.Visibility `json:"visibility"`
+	}
+
+	playlist, ok := cfg.getOwnedPlaylist(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.Title != nil {
+		if *params.Title == "" {
+			respondWithError(w, http.StatusBadRequest, "Title can't be empty", nil)
+			return
+		}
+		playlist.Title = *params.Title
+	}
+	if params.Description != nil {
+		playlist.Description = *params.Description
+	}
+	if params.Visibility != nil {
+		if !params.Visibility.Valid() {
+			respondWithError(w, http.StatusBadRequest, "Invalid visibility", nil)
+			return
+		}
+		playlist.Visibility = *params.Visibility
+	}
+
+	err = cfg.db.UpdatePlaylist(playlist)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update playlist", err)
+		return
+	}
+
+	playlist, err = cfg.db.GetPlaylist(playlist.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get playlist", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, playlist)
+}
+
+func (cfg *apiConfig) handlerPlaylistDelete(w http.ResponseWriter, r *http.Request) {
+	playlist, ok := cfg.getOwnedPlaylist(w, r)
+	if !ok {
+		return
+	}
+
+	err := cfg.db.DeletePlaylist(playlist.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete playlist", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerPlaylistItemAdd(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		VideoID  uuid.UUID `json:"video_id"`
+		Position *int      `json:"position"`
+	}
+	type response struct {
+		ID uuid.UUID `json:"id"`
+	}
+
+	playlist, ok := cfg.getOwnedPlaylist(w, r)
+	if !ok {
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err := decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(params.VideoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil || !video.CanBeViewedBy(playlist.UserID) {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+
+	itemID, err := cfg.db.AddPlaylistItem(playlist.ID, video.ID, params.Position)
+	if errors.Is(err, database.ErrDuplicatePlaylistItem) {
+		respondWithError(w, http.StatusConflict, "Video is already in the playlist", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't add video to playlist", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, response{ID: itemID})
+}
+
+func (cfg *apiConfig) handlerPlaylistItemMove(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Position *int `json:"position"`
+	}
+
+	playlist, ok := cfg.getOwnedPlaylist(w, r)
+	if !ok {
+		return
+	}
+
+	itemIDString := r.PathValue("itemID")
+	itemID, err := uuid.Parse(itemIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid item ID", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.Position == nil {
+		respondWithError(w, http.StatusBadRequest, "Position is required", nil)
+		return
+	}
+
+	found, err := cfg.db.MovePlaylistItem(playlist.ID, itemID, *params.Position)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't move playlist item", err)
+		return
+	}
+	if !found {
+		respondWithError(w, http.StatusNotFound, "Playlist item not found", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (cfg *apiConfig) handlerPlaylistItemDelete(w http.ResponseWriter, r *http.Request) {
+	playlist, ok := cfg.getOwnedPlaylist(w, r)
+	if !ok {
+		return
+	}
+
+	itemIDString := r.PathValue("itemID")
+	itemID, err := uuid.Parse(itemIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid item ID", err)
+		return
+	}
+
+	found, err := cfg.db.RemovePlaylistItem(playlist.ID, itemID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't remove playlist item", err)
+		return
+	}
+	if !found {
+		respondWithError(w, http.StatusNotFound, "Playlist item not found", nil)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getOwnedPlaylist authenticates the request and loads the {playlistID} it
+// targets, responding with an error and returning false unless the caller owns
+// it.
+func (cfg *apiConfig) getOwnedPlaylist(w http.ResponseWriter, r *http.Request) (database.Playlist, bool) {
+	playlistIDString := r.PathValue("playlistID")
+	playlistID, err := uuid.Parse(playlistIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid playlist ID", err)
+		return database.Playlist{}, false
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return database.Playlist{}, false
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return database.Playlist{}, false
+	}
+
+	playlist, err := cfg.db.GetPlaylist(playlistID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get playlist", err)
+		return database.Playlist{}, false
+	}
+	if playlist.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Playlist not found", nil)
+		return database.Playlist{}, false
+	}
+	if playlist.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't modify this playlist", nil)
+		return database.Playlist{}, false
+	}
+
+	return playlist, true
+}
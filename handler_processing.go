@@ -0,0 +1,112 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/database"
+)
+
+const (
+	// How often the event stream checks for new progress
+	processingPollInterval = time.Second
+	// Idle streams get a comment this often so proxies don't close them
+	processingHeartbeatInterval = 15 * time.Second
+)
+
+// handlerProcessingGet returns the latest processing job for a video the
+// user owns.
+func (cfg *apiConfig) handlerProcessingGet(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	job, err := cfg.db.GetLatestProcessingJob(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get processing job", err)
+		return
+	}
+	if job.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Video hasn't been processed", nil)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, job)
+}
+
+// handlerProcessingEvents streams a video's latest processing job as
+// Server-Sent Events, sending a "progress" event with the job whenever it
+// changes, including when a new upload starts a new job. The stream stays
+// open until the client goes away; clients waiting on an upload can stop
+// once the job they're following has succeeded or failed.
+func (cfg *apiConfig) handlerProcessingEvents(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	controller := http.NewResponseController(w)
+	if err := controller.Flush(); err != nil {
+		log.Printf("Couldn't stream processing events: %v", err)
+		return
+	}
+
+	ticker := time.NewTicker(processingPollInterval)
+	defer ticker.Stop()
+
+	var last database.ProcessingJob
+	lastWrite := cfg.clock.Now()
+	for {
+		job, err := cfg.db.GetLatestProcessingJob(video.ID)
+		if err != nil {
+			log.Printf("Couldn't get processing job for video %s: %v", video.ID, err)
+			return
+		}
+
+		wrote := false
+		if job.ID != uuid.Nil && !reflect.DeepEqual(job, last) {
+			err = writeEvent(w, "progress", job)
+			last = job
+			wrote = true
+		} else if cfg.clock.Now().Sub(lastWrite) >= processingHeartbeatInterval {
+			_, err = io.WriteString(w, ": keep-alive\n\n")
+			wrote = true
+		}
+		if wrote {
+			if err == nil {
+				err = controller.Flush()
+			}
+			if err != nil {
+				// The client has gone
+				return
+			}
+			lastWrite = cfg.clock.Now()
+		}
+
+		select {
+		case <-r.Context().Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// writeEvent writes a Server-Sent Event with data encoded as JSON.
+func writeEvent(w io.Writer, event string, data any) error {
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, encoded)
+	return err
+}
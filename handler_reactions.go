@@ -0,0 +1,169 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/auth"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/database"
+)
+
+type reactionsResponse struct {
+	Counts map[database.Reaction]int `json:"counts"`
+	Mine   []database.Reaction       `json:"mine"`
+}
+
+func (cfg *apiConfig) handlerReactionAdd(w http.ResponseWriter, r *http.Request) {
+	cfg.setReaction(w, r, true)
+}
+
+func (cfg *apiConfig) handlerReactionDelete(w http.ResponseWriter, r *http.Request) {
+	cfg.setReaction(w, r, false)
+}
+
+// setReaction backs both PUT and DELETE on a reaction, which are idempotent
+// so clients can retry or double-click safely. Either way the response is the
+// video's updated reactions.
+func (cfg *apiConfig) setReaction(w http.ResponseWriter, r *http.Request, add bool) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	reaction := database.Reaction(r.PathValue("reaction"))
+	if !reaction.Valid() {
+		respondWithError(w, http.StatusBadRequest, "Unknown reaction", nil)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil || !video.CanBeViewedBy(userID) {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+
+	if add {
+		err = cfg.db.AddReaction(userID, videoID, reaction)
+	} else {
+		err = cfg.db.RemoveReaction(userID, videoID, reaction)
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update reaction", err)
+		return
+	}
+
+	cfg.respondWithReactions(w, userID, videoID)
+}
+
+func (cfg *apiConfig) handlerReactionsGet(w http.ResponseWriter, r *http.Request) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	userID := uuid.Nil
+	token, err := auth.GetBearerToken(r.Header)
+	if err == nil {
+		userID, err = auth.ValidateJWT(token, cfg.jwtSecret)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+			return
+		}
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil || !video.CanBeViewedBy(userID) {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+
+	cfg.respondWithReactions(w, userID, videoID)
+}
+
+func (cfg *apiConfig) respondWithReactions(w http.ResponseWriter, userID, videoID uuid.UUID) {
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+
+	mine := []database.Reaction{}
+	if userID != uuid.Nil {
+		mine, err = cfg.db.GetUserReactions(userID, videoID)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't get reactions", err)
+			return
+		}
+	}
+
+	respondWithJSON(w, http.StatusOK, reactionsResponse{
+		Counts: video.Reactions,
+		Mine:   mine,
+	})
+}
+
+func (cfg *apiConfig) handlerLikedVideosRetrieve(w http.ResponseWriter, r *http.Request) {
+	const defaultLimit = 20
+	const maxLimit = 100
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	query := r.URL.Query()
+	limit := defaultLimit
+	if limitString := query.Get("limit"); limitString != "" {
+		limit, err = strconv.Atoi(limitString)
+		if err != nil || limit < 1 || limit > maxLimit {
+			respondWithError(w, http.StatusBadRequest, "Invalid limit", err)
+			return
+		}
+	}
+	offset := 0
+	if offsetString := query.Get("offset"); offsetString != "" {
+		offset, err = strconv.Atoi(offsetString)
+		if err != nil || offset < 0 {
+			respondWithError(w, http.StatusBadRequest, "Invalid offset", err)
+			return
+		}
+	}
+
+	videos, err := cfg.db.GetLikedVideos(userID, limit, offset)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve liked videos", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, videos)
+}
@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/auth"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/database"
+)
+
+// Upper bound on how long a presigned playback URL handed out via a share
+// link stays valid, regardless of when the link itself expires.
+const sharePlaybackURLExpiry = 1 * time.Hour
+
+func (cfg *apiConfig) handlerShareLinkCreate(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		ExpiresAt time.Time `json:"expires_at"`
+		MaxViews  *int      `json:"max_views"`
+		Password  string    `json:"password"`
+	}
+
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't share this video", nil)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if !params.ExpiresAt.After(time.Now()) {
+		respondWithError(w, http.StatusBadRequest, "expires_at must be in the future", nil)
+		return
+	}
+	if params.MaxViews != nil && *params.MaxViews < 1 {
+		respondWithError(w, http.StatusBadRequest, "max_views must be at least 1", nil)
+		return
+	}
+
+	var passwordHash *string
+	if params.Password != "" {
+		hash, err := auth.HashPassword(params.Password)
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't hash password", err)
+			return
+		}
+		passwordHash = &hash
+	}
+
+	shareToken, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create share token", err)
+		return
+	}
+
+	link, err := cfg.db.CreateShareLink(shareToken, database.CreateShareLinkParams{
+		VideoID:   videoID,
+		ExpiresAt: params.ExpiresAt,
+		MaxViews:  params.MaxViews,
+	}, passwordHash)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create share link", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, link)
+}
+
+func (cfg *apiConfig) handlerShareLinksRetrieve(w http.ResponseWriter, r *http.Request) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't view share links for this video", nil)
+		return
+	}
+
+	links, err := cfg.db.GetShareLinks(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve share links", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, links)
+}
+
+func (cfg *apiConfig) handlerShareLinkDelete(w http.ResponseWriter, r *http.Request) {
+	shareToken := r.PathValue("token")
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	link, err := cfg.db.GetShareLink(shareToken)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get share link", err)
+		return
+	}
+	if link.Token == "" {
+		respondWithError(w, http.StatusNotFound, "Share link not found", nil)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(link.VideoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't delete this share link", nil)
+		return
+	}
+
+	err = cfg.db.DeleteShareLink(shareToken)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete share link", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerShareLinkResolve is public: anyone holding the token (and password,
+// if set) can exchange it for a short-lived signed playback URL.
+func (cfg *apiConfig) handlerShareLinkResolve(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Password string `json:"password"`
+	}
+	type response struct {
+		Video       database.Video `json:"video"`
+		PlaybackURL string         `json:"playback_url"`
+		ExpiresAt   time.Time      `json:"expires_at"`
+	}
+
+	shareToken := r.PathValue("token")
+
+	params := parameters{}
+	if r.ContentLength != 0 {
+		decoder := json.NewDecoder(r.Body)
+		err := decoder.Decode(&params)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+			return
+		}
+	}
+
+	link, err := cfg.db.GetShareLink(shareToken)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get share link", err)
+		return
+	}
+	// Deliberately indistinguishable from an expired link
+	if link.Token == "" || !link.ExpiresAt.After(time.Now()) {
+		respondWithError(w, http.StatusNotFound, "Share link not found or expired", nil)
+		return
+	}
+
+	if link.HasPassword {
+		if params.Password == "" {
+			respondWithError(w, http.StatusUnauthorized, "Password required", nil)
+			return
+		}
+		err = auth.CheckPasswordHash(params.Password, *link.Password)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Incorrect password", nil)
+			return
+		}
+	}
+
+	video, err := cfg.db.GetVideo(link.VideoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.VideoURL == nil {
+		respondWithError(w, http.StatusNotFound, "Video has no content yet", nil)
+		return
+	}
+	key, ok := cfg.storageKeyFromURL(*video.VideoURL)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign playback URL", fmt.Errorf("share_link: unrecognised video URL %s", *video.VideoURL))
+		return
+	}
+
+	// Only count the view once we know we can actually serve it
+	ok, err = cfg.db.ConsumeShareLinkView(link.Token)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't record view", err)
+		return
+	}
+	if !ok {
+		respondWithError(w, http.StatusGone, "Share link has reached its view limit", nil)
+		return
+	}
+
+	expiry := min(sharePlaybackURLExpiry, time.Until(link.ExpiresAt))
+	playbackURL, err := generatePresignedURL(cfg.s3Client, cfg.s3Bucket, key, expiry)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign playback URL", err)
+		return
+	}
+
+	// The canonical distribution URL would bypass the link's restrictions
+	video.VideoURL = nil
+	respondWithJSON(w, http.StatusOK, response{
+		Video:       video,
+		PlaybackURL: playbackURL,
+		ExpiresAt:   time.Now().Add(expiry).UTC(),
+	})
+}
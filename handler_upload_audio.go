@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+
+	"github.com/google/uuid"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/auth"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/database"
+)
+
+// Audio formats we accept, under the media types browsers and tools
+// commonly send for them
+var audioUploadMediaTypes = map[string]bool{
+	"audio/mpeg":     true,
+	"audio/mp3":      true,
+	"audio/mp4":      true,
+	"audio/x-m4a":    true,
+	"audio/m4a":      true,
+	"audio/wav":      true,
+	"audio/x-wav":    true,
+	"audio/wave":     true,
+	"audio/vnd.wave": true,
+	"audio/flac":     true,
+	"audio/x-flac":   true,
+}
+
+// handlerUploadAudio is the audio-only counterpart of handlerUploadVideo, for
+// podcasts and other media without pictures.
+func (cfg *apiConfig) handlerUploadAudio(w http.ResponseWriter, r *http.Request) {
+	const maxUploadSize = 500 << 20 // 500 MB
+
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	// Authenticate the user
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	// Check authorisation
+	videoMeta, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to get video", err)
+		return
+	}
+	if videoMeta.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You are not allowed to upload content for this video", nil)
+		return
+	}
+
+	const maxMemory = 10 << 20 // 10 MB
+	r.ParseMultipartForm(maxMemory)
+
+	// "audio" should match the HTML form input name
+	uploadFile, header, err := r.FormFile("audio")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Unable to parse form file", err)
+		return
+	}
+	defer uploadFile.Close()
+
+	options, err := parseProcessingOptions(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	contentType := header.Header.Get("Content-Type")
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Unable to parse Content-Type", fmt.Errorf("upload_audio: %s", err))
+		return
+	}
+	if !audioUploadMediaTypes[mediaType] {
+		respondWithError(w, http.StatusBadRequest, "Invalid file type", fmt.Errorf("upload_audio: expected MP3, M4A, WAV or FLAC audio, got %s", mediaType))
+		return
+	}
+
+	tempFile, err := os.CreateTemp("", "tubely-upload-audio")
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to create temporary file", err)
+		return
+	}
+	defer os.Remove(tempFile.Name())
+	defer tempFile.Close()
+
+	copySize, err := io.Copy(tempFile, io.LimitReader(uploadFile, maxUploadSize+1))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to copy file", err)
+		return
+	}
+	if copySize > maxUploadSize {
+		respondWithError(w, http.StatusBadRequest, "File too large", fmt.Errorf("upload_audio: file size exceeds limit %d", maxUploadSize))
+		return
+	}
+
+	job := cfg.startProcessingJob(videoMeta.ID, stageTranscoding)
+	videoMeta, err = cfg.processMedia(r.Context(), job, videoMeta, tempFile.Name(), database.MediaKindAudio, userID, options)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Unable to process audio", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, videoMeta)
+}
@@ -1,9 +1,7 @@
 package main
 
 import (
-	"bytes"
-	"crypto/rand"
-	"encoding/base64"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -11,13 +9,12 @@ import (
 	"mime"
 	"net/http"
 	"os"
-	"os/exec"
+	"strconv"
 
-	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/google/uuid"
 	"github.com/venzy/learn-file-storage-s3-golang/internal/auth"
-	"github.com/venzy/learn-file-storage-s3-golang/internal/fileext"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/database"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/media"
 )
 
 func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request) {
@@ -71,6 +68,19 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 	}
 	defer uploadFile.Close()
 
+	options, err := parseProcessingOptions(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	var cleanupWatermark func()
+	options.Watermark, cleanupWatermark, err = cfg.uploadWatermark(r.Context(), r, userID)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Unable to use watermark", err)
+		return
+	}
+	defer cleanupWatermark()
+
 	// `uploadFile` is an `io.Reader` that we can read from to get the file data
 
 	contentType := header.Header.Get("Content-Type")
@@ -79,19 +89,11 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 		respondWithError(w, http.StatusBadRequest, "Unable to parse Content-Type", fmt.Errorf("upload_video: %s", err))
 		return
 	}
-	if mediaType != "video/mp4" {
-		respondWithError(w, http.StatusBadRequest, "Invalid file type", fmt.Errorf("upload_video: expected video/mp4, got %s", mediaType))
+	if mediaType != "video/mp4" && mediaType != "video/x-matroska" {
+		respondWithError(w, http.StatusBadRequest, "Invalid file type", fmt.Errorf("upload_video: expected video/mp4 or video/x-matroska, got %s", mediaType))
 		return
 	}
 
-	// NOTE: Could use mime.ExtensionsByType(mediaType) and pick the first one,
-	// but for now leave with our own little internal module
-	fileExtension := fileext.FromMediaType(mediaType)
-	if fileExtension == "" {
-		// This is an internal error, as we restrict the content types above to a subset of those understood by fileext
-		respondWithError(w, http.StatusInternalServerError, "Unrecognised Content-Type", fmt.Errorf("upload_thumbnail: unknown file extension for content type %s", contentType))
-	}
-
 	// Save as a temporary file
 	tempFile, err := os.CreateTemp("", "tubely-upload.mp4")
 	if err != nil {
@@ -115,81 +117,21 @@ func (cfg *apiConfig) handlerUploadVideo(w http.ResponseWriter, r *http.Request)
 		return
 	}
 
-	// Process the video for fast start
-	processedFilePath, err := processVideoForFastStart(tempFile.Name())
+	job := cfg.startProcessingJob(videoMeta.ID, stageTranscoding)
+	videoMeta, err = cfg.processMedia(r.Context(), job, videoMeta, tempFile.Name(), database.MediaKindVideo, userID, options)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Unable to process video", err)
 		return
 	}
-	defer os.Remove(processedFilePath)
-
-	// Get the aspect ratio of the video
-	aspectRatio, err := getVideoAspectRatio(processedFilePath)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable to get video aspect ratio", err)
-		return
-	}
-
-	// Determine the storage prefix based on the aspect ratio
-	var storagePrefix string
-	switch aspectRatio {
-	case "16:9":
-		storagePrefix = "landscape/"
-	case "9:16":
-		storagePrefix = "portrait/"
-	default:
-		storagePrefix = "other/"
-	}
-
-	// Generate a random filename
-	randBytes := make([]byte, 32)
-	// Guaranteed not to return an error on all but legacy Linux systems
-	rand.Read(randBytes)
-	// Use base64.RawURLEncoding to get a URL-safe string
-	randString := base64.RawURLEncoding.EncodeToString(randBytes)
-	fileName := storagePrefix + randString + fileExtension
-
-	// Open processed file for reading
-	processedFile, err := os.Open(processedFilePath)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable to open processed file", err)
-		return
-	}
-	defer processedFile.Close()
-	
-	// Upload to S3
-	_, err = cfg.s3Client.PutObject(r.Context(), &s3.PutObjectInput{
-		Bucket: aws.String(cfg.s3Bucket),
-		Key:    aws.String(fileName),  // Use the filename directly as the key
-		Body:   processedFile,
-		ContentType: aws.String(mediaType),
-	})
-
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable to upload file", err)
-		return
-	}
-
-	// Update the database with components that will go into the video URL
-	distURL := fmt.Sprintf("https://%s/%s", cfg.s3CfDistribution, fileName)
-	videoMeta.VideoURL = &distURL
-	err = cfg.db.UpdateVideo(videoMeta)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable to update video", err)
-		return
-	}
 
 	// Respond with updated video metadata
 	respondWithJSON(w, http.StatusOK, videoMeta)
 }
 
-func getVideoAspectRatio(filePath string) (string, error) {
-	cmd := exec.Command("ffprobe", "-v", "error", "-print_format", "json", "-show_streams", filePath)
-	resultBuffer := bytes.Buffer{}
-	cmd.Stdout = &resultBuffer
-	err := cmd.Run()
+func (cfg *apiConfig) getVideoAspectRatio(ctx context.Context, filePath string) (string, error) {
+	output, err := cfg.ffprobe(ctx, "-v", "error", "-print_format", "json", "-show_streams", filePath)
 	if err != nil {
-		return "", fmt.Errorf("ffprobe error: %v", err)
+		return "", err
 	}
 
 	// Just extract the first stream's width and height
@@ -202,7 +144,7 @@ func getVideoAspectRatio(filePath string) (string, error) {
 	var ffprobeResult FFProbeResult
 
 	// Parse the JSON output to get the aspect ratio
-	err = json.Unmarshal(resultBuffer.Bytes(), &ffprobeResult)
+	err = json.Unmarshal(output, &ffprobeResult)
 	if err != nil {	
 		return "", fmt.Errorf("json unmarshal error: %v", err)
 	}
@@ -227,16 +169,56 @@ func getVideoAspectRatio(filePath string) (string, error) {
 	}
 }
 
+// aspectClassFromRatio maps the ratios reported by getVideoAspectRatio to the
+// coarse classes we store and filter on.
+func aspectClassFromRatio(aspectRatio string) string {
+	switch aspectRatio {
+	case "16:9":
+		return "landscape"
+	case "9:16":
+		return "portrait"
+	default:
+		return "other"
+	}
+}
+
+func (cfg *apiConfig) getVideoDuration(ctx context.Context, filePath string) (float64, error) {
+	output, err := cfg.ffprobe(ctx, "-v", "error", "-print_format", "json", "-show_format", filePath)
+	if err != nil {
+		return 0, err
+	}
+
+	type FFProbeResult struct {
+		Format struct {
+			Duration string `json:"duration"`
+		} `json:"format"`
+	}
+	var ffprobeResult FFProbeResult
+
+	err = json.Unmarshal(output, &ffprobeResult)
+	if err != nil {
+		return 0, fmt.Errorf("json unmarshal error: %v", err)
+	}
+
+	// ffprobe reports duration as a decimal string
+	duration, err := strconv.ParseFloat(ffprobeResult.Format.Duration, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid duration %q: %v", ffprobeResult.Format.Duration, err)
+	}
+	return duration, nil
+}
+
 func isEqualWithTolerance(a, b, tolerance float64) bool {
 	return math.Abs(a - b) <= tolerance
 }
 
-func processVideoForFastStart(filePath string) (string, error) {
+func (cfg *apiConfig) processVideoForFastStart(ctx context.Context, filePath string, duration float64, report func(media.Progress)) (string, error) {
 	outputFilePath := filePath + ".processing"
-	cmd := exec.Command("ffmpeg", "-i", filePath, "-c", "copy", "-movflags", "faststart", "-f", "mp4", outputFilePath)
-	err := cmd.Run()
+	// Keep every audio stream so players can offer a choice of language;
+	// subtitles are extracted separately as WebVTT
+	err := cfg.ffmpegWithProgress(ctx, report, duration, "-v", "error", "-i", filePath, "-map", "0:v:0", "-map", "0:a?", "-sn", "-dn", "-c", "copy", "-movflags", "faststart", "-f", "mp4", outputFilePath)
 	if err != nil {
-		return "", fmt.Errorf("ffmpeg error: %v", err)
+		return "", err
 	}
 	return outputFilePath, nil
 }
\ No newline at end of file
@@ -2,7 +2,15 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"github.com/google/uuid"
 	"github.com/venzy/learn-file-storage-s3-golang/internal/auth"
@@ -33,6 +41,10 @@ func (cfg *apiConfig) handlerVideoMetaCreate(w http.ResponseWriter, r *http.Requ
 		return
 	}
 	params.UserID = userID
+	if params.Visibility != "" && !params.Visibility.Valid() {
+		respondWithError(w, http.StatusBadRequest, "Invalid visibility", nil)
+		return
+	}
 
 	video, err := cfg.db.CreateVideo(params.CreateVideoParams)
 	if err != nil {
@@ -67,12 +79,18 @@ func (cfg *apiConfig) handlerVideoMetaDelete(w http.ResponseWriter, r *http.Requ
 		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
 		return
 	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
 	if video.UserID != userID {
 		respondWithError(w, http.StatusForbidden, "You can't delete this video", err)
 		return
 	}
 
-	err = cfg.db.DeleteVideo(videoID)
+	// Deleting only moves the video to the trash; trashPurger deletes it for
+	// good once it can no longer be restored
+	err = cfg.db.TrashVideo(videoID, cfg.clock.Now())
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't delete video", err)
 		return
@@ -89,15 +107,211 @@ func (cfg *apiConfig) handlerVideoGet(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Authentication is optional, but needed to see private videos
+	userID := uuid.Nil
+	token, err := auth.GetBearerToken(r.Header)
+	if err == nil {
+		userID, err = auth.ValidateJWT(token, cfg.jwtSecret)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+			return
+		}
+	}
+
 	video, err := cfg.db.GetVideo(videoID)
 	if err != nil {
 		respondWithError(w, http.StatusNotFound, "Couldn't get video", err)
 		return
 	}
+	// Don't reveal that a private video exists
+	if video.ID == uuid.Nil || !video.CanBeViewedBy(userID) {
+		respondWithError(w, http.StatusNotFound, "Couldn't get video", nil)
+		return
+	}
 
+	w.Header().Set("ETag", videoETag(video))
 	respondWithJSON(w, http.StatusOK, video)
 }
 
+// handlerVideoMetaUpdate applies a JSON merge patch (RFC 7386) to the
+// editable fields of a video. Sending the ETag from a previous GET in
+// If-Match guards against overwriting someone else's concurrent edit.
+func (cfg *apiConfig) handlerVideoMetaUpdate(w http.ResponseWriter, r *http.Request) {
+	const maxTitleLength = 200
+	const maxDescriptionLength = 5000
+
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/merge-patch+json" && mediaType != "application/json" {
+		respondWithError(w, http.StatusUnsupportedMediaType, "Expected application/merge-patch+json", nil)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You can't edit this video", nil)
+		return
+	}
+
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch != "" && ifMatch != "*" && ifMatch != videoETag(video) {
+		respondWithError(w, http.StatusPreconditionFailed, "Video has been modified", nil)
+		return
+	}
+
+	patch := map[string]json.RawMessage{}
+	err = json.NewDecoder(r.Body).Decode(&patch)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode patch", err)
+		return
+	}
+
+	for field, value := range patch {
+		// In a merge patch, null means "remove"
+		isNull := string(value) == "null"
+		switch field {
+		case "title":
+			var title string
+			if isNull || json.Unmarshal(value, &title) != nil {
+				respondWithError(w, http.StatusUnprocessableEntity, "title must be a string", nil)
+				return
+			}
+			title = strings.TrimSpace(title)
+			if title == "" || utf8.RuneCountInString(title) > maxTitleLength {
+				respondWithError(w, http.StatusUnprocessableEntity, fmt.Sprintf("title must be between 1 and %d characters", maxTitleLength), nil)
+				return
+			}
+			video.Title = title
+		case "description":
+			var description string
+			if !isNull && json.Unmarshal(value, &description) != nil {
+				respondWithError(w, http.StatusUnprocessableEntity, "description must be a string or null", nil)
+				return
+			}
+			if utf8.RuneCountInString(description) > maxDescriptionLength {
+				respondWithError(w, http.StatusUnprocessableEntity, fmt.Sprintf("description must be at most %d characters", maxDescriptionLength), nil)
+				return
+			}
+			video.Description = description
+		case "visibility":
+			var visibility database.Visibility
+			if isNull || json.Unmarshal(value, &visibility) != nil || !visibility.Valid() {
+				respondWithError(w, http.StatusUnprocessableEntity, "visibility must be one of private, unlisted or public", nil)
+				return
+			}
+			video.Visibility = visibility
+		case "comments_enabled":
+			var enabled bool
+			if isNull || json.Unmarshal(value, &enabled) != nil {
+				respondWithError(w, http.StatusUnprocessableEntity, "comments_enabled must be a boolean", nil)
+				return
+			}
+			video.CommentsEnabled = enabled
+		case "publish_at":
+			if isNull {
+				video.PublishAt = nil
+				video.PublishVisibility = nil
+				break
+			}
+			var publishAt time.Time
+			if json.Unmarshal(value, &publishAt) != nil {
+				respondWithError(w, http.StatusUnprocessableEntity, "publish_at must be an RFC 3339 timestamp or null", nil)
+				return
+			}
+			if !publishAt.After(cfg.clock.Now()) {
+				respondWithError(w, http.StatusUnprocessableEntity, "publish_at must be in the future", nil)
+				return
+			}
+			video.PublishAt = &publishAt
+		case "publish_visibility":
+			var visibility database.Visibility
+			if isNull || json.Unmarshal(value, &visibility) != nil || visibility != database.VisibilityUnlisted && visibility != database.VisibilityPublic {
+				respondWithError(w, http.StatusUnprocessableEntity, "publish_visibility must be unlisted or public", nil)
+				return
+			}
+			video.PublishVisibility = &visibility
+		default:
+			respondWithError(w, http.StatusUnprocessableEntity, fmt.Sprintf("%s is not an editable field", field), nil)
+			return
+		}
+	}
+
+	// A scheduled video stays private until the scheduler publishes it, and
+	// changing the visibility by hand cancels any schedule
+	_, visibilityPatched := patch["visibility"]
+	_, publishAtPatched := patch["publish_at"]
+	if visibilityPatched && !publishAtPatched {
+		video.PublishAt = nil
+	}
+	if video.PublishAt != nil {
+		if visibilityPatched && video.Visibility != database.VisibilityPrivate {
+			respondWithError(w, http.StatusUnprocessableEntity, "visibility must be private while publish_at is set", nil)
+			return
+		}
+		video.Visibility = database.VisibilityPrivate
+		if video.PublishVisibility == nil {
+			visibility := database.VisibilityPublic
+			video.PublishVisibility = &visibility
+		}
+	} else {
+		if _, publishVisibilityPatched := patch["publish_visibility"]; publishVisibilityPatched {
+			respondWithError(w, http.StatusUnprocessableEntity, "publish_visibility requires publish_at", nil)
+			return
+		}
+		video.PublishVisibility = nil
+	}
+
+	// Guard against a concurrent edit between our read and this write too
+	ok, err := cfg.db.UpdateVideoIfUnmodified(video, video.UpdatedAt)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update video", err)
+		return
+	}
+	if !ok {
+		respondWithError(w, http.StatusPreconditionFailed, "Video has been modified", nil)
+		return
+	}
+
+	video, err = cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+
+	w.Header().Set("ETag", videoETag(video))
+	respondWithJSON(w, http.StatusOK, video)
+}
+
+// videoETag derives a strong ETag from updated_at, which every write bumps
+func videoETag(video database.Video) string {
+	return fmt.Sprintf(`"%d"`, video.UpdatedAt.UnixMilli())
+}
+
 func (cfg *apiConfig) handlerVideosRetrieve(w http.ResponseWriter, r *http.Request) {
 	token, err := auth.GetBearerToken(r.Header)
 	if err != nil {
@@ -110,11 +324,105 @@ func (cfg *apiConfig) handlerVideosRetrieve(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	videos, err := cfg.db.GetVideos(userID)
+	params, err := parseListVideosParams(r.URL.Query())
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid query parameters", err)
+		return
+	}
+	params.UserID = userID
+
+	page, err := cfg.db.GetVideos(params)
+	if errors.Is(err, database.ErrInvalidCursor) || errors.Is(err, database.ErrInvalidSort) {
+		respondWithError(w, http.StatusBadRequest, "Invalid query parameters", err)
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve videos", err)
 		return
 	}
 
-	respondWithJSON(w, http.StatusOK, videos)
+	respondWithJSON(w, http.StatusOK, page)
+}
+
+func parseListVideosParams(query url.Values) (database.ListVideosParams, error) {
+	const defaultLimit = 20
+	const maxLimit = 100
+
+	params := database.ListVideosParams{
+		Limit:       defaultLimit,
+		Cursor:      query.Get("cursor"),
+		Sort:        database.VideoSort(query.Get("sort")),
+		Status:      database.VideoStatus(query.Get("status")),
+		AspectClass: query.Get("aspect"),
+		MediaKind:   database.MediaKind(query.Get("kind")),
+	}
+
+	if tag := query.Get("tag"); tag != "" {
+		name, err := normalizeTag(tag)
+		if err != nil {
+			return params, err
+		}
+		params.Tag = name
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxLimit {
+			return params, fmt.Errorf("limit must be between 1 and %d", maxLimit)
+		}
+		params.Limit = n
+	}
+
+	switch order := query.Get("order"); order {
+	case "":
+	case "asc", "desc":
+		descending := order == "desc"
+		params.Descending = &descending
+	default:
+		return params, fmt.Errorf("order must be asc or desc")
+	}
+
+	var err error
+	params.HasVideo, err = parseOptionalBool(query, "has_video")
+	if err != nil {
+		return params, err
+	}
+	params.HasThumbnail, err = parseOptionalBool(query, "has_thumbnail")
+	if err != nil {
+		return params, err
+	}
+	params.CreatedAfter, err = parseOptionalTime(query, "created_after")
+	if err != nil {
+		return params, err
+	}
+	params.CreatedBefore, err = parseOptionalTime(query, "created_before")
+	if err != nil {
+		return params, err
+	}
+
+	return params, nil
+}
+
+func parseOptionalBool(query url.Values, key string) (*bool, error) {
+	value := query.Get(key)
+	if value == "" {
+		return nil, nil
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be a boolean", key)
+	}
+	return &b, nil
+}
+
+func parseOptionalTime(query url.Values, key string) (*time.Time, error) {
+	value := query.Get(key)
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, fmt.Errorf("%s must be an RFC 3339 timestamp", key)
+	}
+	return &t, nil
 }
\ No newline at end of file
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/auth"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/database"
+)
+
+func (cfg *apiConfig) handlerVideosSearch(w http.ResponseWriter, r *http.Request) {
+	const defaultLimit = 20
+	const maxLimit = 50
+
+	// Authentication is optional: anonymous searches only see public videos
+	userID := uuid.Nil
+	token, err := auth.GetBearerToken(r.Header)
+	if err == nil {
+		userID, err = auth.ValidateJWT(token, cfg.jwtSecret)
+		if err != nil {
+			respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+			return
+		}
+	} else if !errors.Is(err, auth.ErrNoAuthHeaderIncluded) {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+
+	query := r.URL.Query()
+	q := query.Get("q")
+	if q == "" {
+		respondWithError(w, http.StatusBadRequest, "Missing search query", nil)
+		return
+	}
+
+	params := database.SearchVideosParams{
+		Query:  q,
+		UserID: userID,
+		Limit:  defaultLimit,
+	}
+	if limit := query.Get("limit"); limit != "" {
+		params.Limit, err = strconv.Atoi(limit)
+		if err != nil || params.Limit < 1 || params.Limit > maxLimit {
+			respondWithError(w, http.StatusBadRequest, "Invalid limit", err)
+			return
+		}
+	}
+	if offset := query.Get("offset"); offset != "" {
+		params.Offset, err = strconv.Atoi(offset)
+		if err != nil || params.Offset < 0 {
+			respondWithError(w, http.StatusBadRequest, "Invalid offset", err)
+			return
+		}
+	}
+
+	results, err := cfg.db.SearchVideos(params)
+	if errors.Is(err, database.ErrSearchUnavailable) {
+		respondWithError(w, http.StatusNotImplemented, "Search is not enabled on this server", err)
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't search videos", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, results)
+}
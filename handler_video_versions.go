@@ -0,0 +1,112 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/auth"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/database"
+)
+
+func (cfg *apiConfig) handlerVideoVersionsRetrieve(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	versions, err := cfg.db.GetVideoVersions(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve video versions", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, versions)
+}
+
+// handlerVideoVersionActivate rolls a video back (or forward) to one of its
+// earlier uploads without re-uploading it.
+func (cfg *apiConfig) handlerVideoVersionActivate(w http.ResponseWriter, r *http.Request) {
+	video, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
+
+	versionIDString := r.PathValue("versionID")
+	versionID, err := uuid.Parse(versionIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid version ID", err)
+		return
+	}
+
+	if video.Status == database.VideoStatusProcessing {
+		respondWithError(w, http.StatusConflict, "Video is still processing an upload", nil)
+		return
+	}
+
+	version, err := cfg.db.GetVideoVersion(video.ID, versionID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video version", err)
+		return
+	}
+	if version.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Video version not found", nil)
+		return
+	}
+
+	err = cfg.db.ActivateVideoVersion(version, cfg.storageURL(version.StorageKey))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't activate video version", err)
+		return
+	}
+
+	video, err = cfg.db.GetVideo(video.ID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	video, err = cfg.syncWaveformThumbnail(video)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update thumbnail", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, video)
+}
+
+// getOwnedVideo authenticates the request and loads the {videoID} it targets,
+// responding with an error and returning false unless the caller owns it.
+func (cfg *apiConfig) getOwnedVideo(w http.ResponseWriter, r *http.Request) (database.Video, bool) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return database.Video{}, false
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return database.Video{}, false
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return database.Video{}, false
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return database.Video{}, false
+	}
+	if video.ID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return database.Video{}, false
+	}
+	if video.UserID != userID {
+		respondWithError(w, http.StatusForbidden, "You don't own this video", nil)
+		return database.Video{}, false
+	}
+
+	return video, true
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/auth"
+)
+
+// How close to the end a viewer has to get for the video to count as
+// finished, dropping it from their continue watching list.
+const watchCompletedThreshold = 0.95
+
+func (cfg *apiConfig) handlerWatchProgressPut(w http.ResponseWriter, r *http.Request) {
+	type parameters struct {
+		Position *float64 `json:"position"`
+	}
+
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	params := parameters{}
+	err = decoder.Decode(&params)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't decode parameters", err)
+		return
+	}
+	if params.Position == nil || *params.Position < 0 {
+		respondWithError(w, http.StatusBadRequest, "Position must be a non-negative number of seconds", nil)
+		return
+	}
+
+	video, err := cfg.db.GetVideo(videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get video", err)
+		return
+	}
+	if video.ID == uuid.Nil || !video.CanBeViewedBy(userID) {
+		respondWithError(w, http.StatusNotFound, "Video not found", nil)
+		return
+	}
+
+	position := *params.Position
+	completed := false
+	if video.Duration != nil && *video.Duration > 0 {
+		position = min(position, *video.Duration)
+		completed = position >= *video.Duration*watchCompletedThreshold
+	}
+
+	progress, err := cfg.db.SetWatchProgress(userID, videoID, position, completed)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save progress", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, progress)
+}
+
+func (cfg *apiConfig) handlerWatchProgressGet(w http.ResponseWriter, r *http.Request) {
+	videoIDString := r.PathValue("videoID")
+	videoID, err := uuid.Parse(videoIDString)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid ID", err)
+		return
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	progress, err := cfg.db.GetWatchProgress(userID, videoID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get progress", err)
+		return
+	}
+	if progress.VideoID == uuid.Nil {
+		respondWithError(w, http.StatusNotFound, "No progress recorded for this video", nil)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, progress)
+}
+
+func (cfg *apiConfig) handlerContinueWatching(w http.ResponseWriter, r *http.Request) {
+	const defaultLimit = 20
+	const maxLimit = 100
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	limit := defaultLimit
+	if limitString := r.URL.Query().Get("limit"); limitString != "" {
+		limit, err = strconv.Atoi(limitString)
+		if err != nil || limit < 1 || limit > maxLimit {
+			respondWithError(w, http.StatusBadRequest, "Invalid limit", err)
+			return
+		}
+	}
+
+	items, err := cfg.db.GetContinueWatching(userID, limit)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve continue watching list", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, items)
+}
@@ -0,0 +1,335 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image/png"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/auth"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/database"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/watermark"
+)
+
+const maxWatermarkSize = 2 << 20 // 2 MB
+
+// handlerWatermarkPut sets the caller's default watermark from an optional
+// PNG in the "watermark" form field (required the first time) and optional
+// position, opacity and scale fields.
+func (cfg *apiConfig) handlerWatermarkPut(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxWatermarkSize+(64<<10))
+	err = r.ParseMultipartForm(maxWatermarkSize)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Unable to parse form", err)
+		return
+	}
+
+	existing, err := cfg.db.GetWatermark(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get watermark", err)
+		return
+	}
+	base := watermark.Default
+	if existing.URL != "" {
+		base = watermarkConfig(existing)
+	}
+	config, err := parseWatermarkConfig(r, "", base)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+
+	updated := database.Watermark{
+		UserID:   userID,
+		URL:      existing.URL,
+		Position: string(config.Position),
+		Opacity:  config.Opacity,
+		Scale:    config.Scale,
+	}
+
+	image, err := readWatermarkImage(r, "watermark")
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error(), err)
+		return
+	}
+	if image == nil && existing.URL == "" {
+		respondWithError(w, http.StatusBadRequest, "A watermark PNG is required", nil)
+		return
+	}
+	if image != nil {
+		key := randomStorageKey("watermarks/", ".png")
+		err = cfg.putObject(r.Context(), key, bytes.NewReader(image), "image/png")
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, "Unable to upload watermark", err)
+			return
+		}
+		updated.URL = cfg.storageURL(key)
+	}
+
+	err = cfg.db.SetWatermark(updated)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't save watermark", err)
+		return
+	}
+	if image != nil && existing.URL != "" {
+		cfg.deleteWatermarkBlob(r.Context(), existing)
+	}
+
+	updated, err = cfg.db.GetWatermark(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get watermark", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, updated)
+}
+
+func (cfg *apiConfig) handlerWatermarkGet(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	existing, err := cfg.db.GetWatermark(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get watermark", err)
+		return
+	}
+	if existing.URL == "" {
+		respondWithError(w, http.StatusNotFound, "No watermark set", nil)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, existing)
+}
+
+func (cfg *apiConfig) handlerWatermarkDelete(w http.ResponseWriter, r *http.Request) {
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't find JWT", err)
+		return
+	}
+	userID, err := auth.ValidateJWT(token, cfg.jwtSecret)
+	if err != nil {
+		respondWithError(w, http.StatusUnauthorized, "Couldn't validate JWT", err)
+		return
+	}
+
+	existing, err := cfg.db.GetWatermark(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get watermark", err)
+		return
+	}
+	if existing.URL == "" {
+		respondWithError(w, http.StatusNotFound, "No watermark set", nil)
+		return
+	}
+
+	err = cfg.db.DeleteWatermark(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't delete watermark", err)
+		return
+	}
+	cfg.deleteWatermarkBlob(r.Context(), existing)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handlerVideoOriginal gives the owner a short-lived link to download the
+// active version as uploaded, without any watermark.
+func (cfg *apiConfig) handlerVideoOriginal(w http.ResponseWriter, r *http.Request) {
+	const linkExpiry = 15 * time.Minute
+
+	type response struct {
+		URL       string    `json:"url"`
+		ExpiresAt time.Time `json:"expires_at"`
+	}
+
+	video, ok := cfg.getOwnedVideo(w, r)
+	if !ok {
+		return
+	}
+	if video.ActiveVersionID == nil {
+		respondWithError(w, http.StatusNotFound, "Video has no media", nil)
+		return
+	}
+
+	// Versions without a watermark don't keep a separate original
+	url, err := cfg.db.GetVersionAsset(*video.ActiveVersionID, database.AssetOriginal)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't get original", err)
+		return
+	}
+	if url == "" {
+		url = *video.VideoURL
+	}
+	key, ok := cfg.storageKeyFromURL(url)
+	if !ok {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't find original", fmt.Errorf("unrecognised storage URL %s", url))
+		return
+	}
+
+	presignedURL, err := generatePresignedURL(cfg.s3Client, cfg.s3Bucket, key, linkExpiry)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't generate download link", err)
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, response{
+		URL:       presignedURL,
+		ExpiresAt: time.Now().Add(linkExpiry).UTC(),
+	})
+}
+
+func watermarkConfig(w database.Watermark) watermark.Config {
+	return watermark.Config{
+		Position: watermark.Position(w.Position),
+		Opacity:  w.Opacity,
+		Scale:    w.Scale,
+	}
+}
+
+// parseWatermarkConfig overrides base with any of the prefixed position,
+// opacity and scale form fields present in the request.
+func parseWatermarkConfig(r *http.Request, prefix string, base watermark.Config) (watermark.Config, error) {
+	config := base
+	if position := r.FormValue(prefix + "position"); position != "" {
+		config.Position = watermark.Position(position)
+	}
+	if opacity := r.FormValue(prefix + "opacity"); opacity != "" {
+		value, err := strconv.ParseFloat(opacity, 64)
+		if err != nil {
+			return watermark.Config{}, fmt.Errorf("%sopacity must be a number", prefix)
+		}
+		config.Opacity = value
+	}
+	if scale := r.FormValue(prefix + "scale"); scale != "" {
+		value, err := strconv.ParseFloat(scale, 64)
+		if err != nil {
+			return watermark.Config{}, fmt.Errorf("%sscale must be a number", prefix)
+		}
+		config.Scale = value
+	}
+	err := config.Validate()
+	if err != nil {
+		return watermark.Config{}, fmt.Errorf("invalid watermark: %w", err)
+	}
+	return config, nil
+}
+
+// readWatermarkImage reads and checks the PNG in the named form field,
+// returning nil if there isn't one.
+func readWatermarkImage(r *http.Request, field string) ([]byte, error) {
+	file, _, err := r.FormFile(field)
+	if errors.Is(err, http.ErrMissingFile) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, errors.New("unable to parse watermark file")
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxWatermarkSize+1))
+	if err != nil {
+		return nil, errors.New("unable to read watermark file")
+	}
+	if len(data) > maxWatermarkSize {
+		return nil, errors.New("watermark file too large")
+	}
+	if _, err := png.DecodeConfig(bytes.NewReader(data)); err != nil {
+		return nil, errors.New("watermark must be a PNG image")
+	}
+	return data, nil
+}
+
+// uploadWatermark works out which watermark, if any, an upload gets: the
+// PNG sent with it in "watermark_image", otherwise the uploader's default,
+// unless "watermark" is "off". The image is written to a temporary file that
+// the returned cleanup function removes.
+func (cfg *apiConfig) uploadWatermark(ctx context.Context, r *http.Request, userID uuid.UUID) (*appliedWatermark, func(), error) {
+	noCleanup := func() {}
+	if r.FormValue("watermark") == "off" {
+		return nil, noCleanup, nil
+	}
+
+	image, err := readWatermarkImage(r, "watermark_image")
+	if err != nil {
+		return nil, noCleanup, err
+	}
+	existing, err := cfg.db.GetWatermark(userID)
+	if err != nil {
+		return nil, noCleanup, err
+	}
+	if image == nil && existing.URL == "" {
+		return nil, noCleanup, nil
+	}
+
+	base := watermark.Default
+	if existing.URL != "" {
+		base = watermarkConfig(existing)
+	}
+	config, err := parseWatermarkConfig(r, "watermark_", base)
+	if err != nil {
+		return nil, noCleanup, err
+	}
+
+	imageFile, err := os.CreateTemp("", "tubely-watermark.png")
+	if err != nil {
+		return nil, noCleanup, err
+	}
+	imageFile.Close()
+	cleanup := func() { os.Remove(imageFile.Name()) }
+
+	if image != nil {
+		err = os.WriteFile(imageFile.Name(), image, 0o600)
+	} else {
+		key, ok := cfg.storageKeyFromURL(existing.URL)
+		if !ok {
+			err = fmt.Errorf("unrecognised watermark URL %s", existing.URL)
+		} else {
+			err = cfg.downloadObject(ctx, key, imageFile.Name())
+		}
+	}
+	if err != nil {
+		cleanup()
+		return nil, noCleanup, err
+	}
+
+	return &appliedWatermark{Config: config, ImagePath: imageFile.Name()}, cleanup, nil
+}
+
+func (cfg *apiConfig) deleteWatermarkBlob(ctx context.Context, existing database.Watermark) {
+	key, ok := cfg.storageKeyFromURL(existing.URL)
+	if !ok {
+		return
+	}
+	err := cfg.deleteObject(ctx, key)
+	if err != nil {
+		log.Printf("Couldn't delete watermark file: %v", err)
+	}
+}
@@ -0,0 +1,185 @@
+// Package captions validates caption files and converts them to WebVTT, the
+// format browsers' <track> elements understand.
+package captions
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrNoCues = errors.New("captions: file has no cues")
+
+// Hours are optional in WebVTT, and SRT files in the wild use either a comma
+// or a full stop before the milliseconds
+var timestampPattern = regexp.MustCompile(`^(?:(\d+):)?([0-5]\d):([0-5]\d)[,.](\d{3})$`)
+
+type cue struct {
+	start time.Duration
+	end   time.Duration
+	// Anything after the end timestamp on the timing line, e.g. WebVTT cue
+	// settings, which are kept as they are
+	settings string
+	text     []string
+}
+
+// ToWebVTT validates data as either WebVTT or SRT and returns it as WebVTT.
+func ToWebVTT(data []byte) ([]byte, error) {
+	text := normalizeNewlines(string(data))
+	if isWebVTT(text) {
+		err := validateWebVTT(text)
+		if err != nil {
+			return nil, err
+		}
+		return []byte(text), nil
+	}
+
+	cues, err := parseSRT(text)
+	if err != nil {
+		return nil, err
+	}
+	return formatWebVTT(cues), nil
+}
+
+func normalizeNewlines(s string) string {
+	s = strings.TrimPrefix(s, "\ufeff")
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.ReplaceAll(s, "\r", "\n")
+}
+
+// isWebVTT checks for the WEBVTT signature, which may be followed by a
+// space or tab and a header on the same line.
+func isWebVTT(s string) bool {
+	if !strings.HasPrefix(s, "WEBVTT") {
+		return false
+	}
+	rest := s[len("WEBVTT"):]
+	return rest == "" || rest[0] == ' ' || rest[0] == '\t' || rest[0] == '\n'
+}
+
+func validateWebVTT(s string) error {
+	cueCount := 0
+	for i, line := range strings.Split(s, "\n") {
+		if !strings.Contains(line, "-->") {
+			continue
+		}
+		_, err := parseTimingLine(line)
+		if err != nil {
+			return fmt.Errorf("captions: line %d: %w", i+1, err)
+		}
+		cueCount++
+	}
+	if cueCount == 0 {
+		return ErrNoCues
+	}
+	return nil
+}
+
+func parseSRT(s string) ([]cue, error) {
+	lines := strings.Split(s, "\n")
+	cues := []cue{}
+	for i := 0; i < len(lines); i++ {
+		if strings.TrimSpace(lines[i]) == "" {
+			continue
+		}
+
+		// Each block starts with a sequence number, though we don't rely on
+		// them being present or in order
+		if !strings.Contains(lines[i], "-->") {
+			if _, err := strconv.Atoi(strings.TrimSpace(lines[i])); err != nil || i+1 >= len(lines) {
+				return nil, fmt.Errorf("captions: line %d: expected a cue number or timing", i+1)
+			}
+			i++
+		}
+
+		c, err := parseTimingLine(lines[i])
+		if err != nil {
+			return nil, fmt.Errorf("captions: line %d: %w", i+1, err)
+		}
+		// SRT has no cue settings; anything there is old-style positioning
+		c.settings = ""
+
+		for i+1 < len(lines) && strings.TrimSpace(lines[i+1]) != "" {
+			i++
+			// "-->" isn't allowed in WebVTT cue text
+			c.text = append(c.text, strings.ReplaceAll(lines[i], "-->", "--&gt;"))
+		}
+		cues = append(cues, c)
+	}
+	if len(cues) == 0 {
+		return nil, ErrNoCues
+	}
+	return cues, nil
+}
+
+func parseTimingLine(line string) (cue, error) {
+	startString, rest, ok := strings.Cut(line, "-->")
+	if !ok {
+		return cue{}, errors.New("expected a cue timing")
+	}
+	start, err := parseTimestamp(strings.TrimSpace(startString))
+	if err != nil {
+		return cue{}, err
+	}
+	fields := strings.Fields(rest)
+	if len(fields) == 0 {
+		return cue{}, errors.New("missing cue end time")
+	}
+	end, err := parseTimestamp(fields[0])
+	if err != nil {
+		return cue{}, err
+	}
+	if end < start {
+		return cue{}, errors.New("cue ends before it starts")
+	}
+	return cue{start: start, end: end, settings: strings.Join(fields[1:], " ")}, nil
+}
+
+func parseTimestamp(s string) (time.Duration, error) {
+	match := timestampPattern.FindStringSubmatch(s)
+	if match == nil {
+		return 0, fmt.Errorf("invalid timestamp %q", s)
+	}
+	hours := 0
+	if match[1] != "" {
+		hours, _ = strconv.Atoi(match[1])
+	}
+	minutes, _ := strconv.Atoi(match[2])
+	seconds, _ := strconv.Atoi(match[3])
+	millis, _ := strconv.Atoi(match[4])
+	return time.Duration(hours)*time.Hour +
+		time.Duration(minutes)*time.Minute +
+		time.Duration(seconds)*time.Second +
+		time.Duration(millis)*time.Millisecond, nil
+}
+
+// FormatTimestamp formats d as a WebVTT timestamp, e.g. 01:02:03.004.
+func FormatTimestamp(d time.Duration) string {
+	hours := d / time.Hour
+	d -= hours * time.Hour
+	minutes := d / time.Minute
+	d -= minutes * time.Minute
+	seconds := d / time.Second
+	d -= seconds * time.Second
+	return fmt.Sprintf("%02d:%02d:%02d.%03d", hours, minutes, seconds, d/time.Millisecond)
+}
+
+func formatWebVTT(cues []cue) []byte {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n")
+	for _, c := range cues {
+		b.WriteString("\n")
+		b.WriteString(FormatTimestamp(c.start) + " --> " + FormatTimestamp(c.end))
+		if c.settings != "" {
+			b.WriteString(" " + c.settings)
+		}
+		b.WriteString("\n")
+		for _, line := range c.text {
+			b.WriteString(line + "\n")
+		}
+	}
+	return []byte(b.String())
+}
@@ -0,0 +1,63 @@
+package captions
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestToWebVTTConvertsSRT(t *testing.T) {
+	srt := "\ufeff1\r\n00:00:01,000 --> 00:00:02,500\r\nHello\r\n<i>world</i>\r\n\r\n" +
+		"2\r\n00:01:02,003 --> 01:00:00,000 X1:10 X2:20\r\nA --> B\r\n"
+	want := "WEBVTT\n\n" +
+		"00:00:01.000 --> 00:00:02.500\nHello\n<i>world</i>\n\n" +
+		"00:01:02.003 --> 01:00:00.000\nA --&gt; B\n"
+
+	got, err := ToWebVTT([]byte(srt))
+	if err != nil {
+		t.Fatalf("ToWebVTT() error = %v", err)
+	}
+	if string(got) != want {
+		t.Errorf("ToWebVTT() = %q; want %q", got, want)
+	}
+}
+
+func TestToWebVTTKeepsWebVTT(t *testing.T) {
+	vtt := "WEBVTT - English\n\nNOTE made by hand\n\nintro\n00:01.000 --> 00:02.000 align:start\nHi\n"
+
+	got, err := ToWebVTT([]byte(vtt))
+	if err != nil {
+		t.Fatalf("ToWebVTT() error = %v", err)
+	}
+	if string(got) != vtt {
+		t.Errorf("ToWebVTT() = %q; want %q", got, vtt)
+	}
+}
+
+func TestToWebVTTRejectsInvalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{"empty", ""},
+		{"no cues", "WEBVTT\n\nNOTE nothing here\n"},
+		{"not captions", "just some text\n"},
+		{"bad timestamp", "1\n00:00:01 --> 00:00:02,000\nHi\n"},
+		{"bad webvtt timestamp", "WEBVTT\n\n00:01.000 --> 00:02\nHi\n"},
+		{"ends before start", "1\n00:00:05,000 --> 00:00:02,000\nHi\n"},
+		{"missing end", "1\n00:00:01,000 -->\nHi\n"},
+		{"number without timing", "1\n"},
+		{"WEBVTTX signature", "WEBVTTX\n\n00:01.000 --> 00:02.000\nHi\n"},
+	}
+
+	for _, tt := range tests {
+		_, err := ToWebVTT([]byte(tt.input))
+		if err == nil {
+			t.Errorf("ToWebVTT(%s) succeeded; want an error", tt.name)
+		}
+	}
+
+	_, err := ToWebVTT(nil)
+	if !errors.Is(err, ErrNoCues) {
+		t.Errorf("ToWebVTT(nil) error = %v; want ErrNoCues", err)
+	}
+}
@@ -0,0 +1,143 @@
+// Package chapters proposes chapter markers from ffmpeg scene detection and
+// renders chapters as WebVTT and as ffmpeg metadata for MP4 chapters.
+package chapters
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/venzy/learn-file-storage-s3-golang/internal/captions"
+)
+
+// Chapter is a titled section of a video, running from Start until the next
+// chapter or the end of the video.
+type Chapter struct {
+	// Seconds from the start of the video
+	Start float64
+	Title string
+}
+
+// How different a frame must be from the last, from 0 to 1, to count as a
+// scene change
+const SceneThreshold = 0.4
+
+// SceneFilter is the ffmpeg video filter that logs the time of each scene
+// change to stderr, to be read by ParseSceneTimes.
+func SceneFilter() string {
+	return fmt.Sprintf("select='gt(scene,%g)',showinfo", SceneThreshold)
+}
+
+var ptsTimePattern = regexp.MustCompile(`pts_time:\s*([0-9]+(?:\.[0-9]+)?)`)
+
+// ParseSceneTimes reads the scene change times in seconds from the showinfo
+// output of SceneFilter, in order.
+func ParseSceneTimes(output []byte) []float64 {
+	times := []float64{}
+	for _, match := range ptsTimePattern.FindAllSubmatch(output, -1) {
+		t, err := strconv.ParseFloat(string(match[1]), 64)
+		if err != nil {
+			continue
+		}
+		times = append(times, t)
+	}
+	sort.Float64s(times)
+	return times
+}
+
+// Propose picks chapter starts from scene changes: the first chapter starts
+// at zero, and each later one at the first scene change at least minLength
+// after the previous chapter. Chapters are spaced further apart if needed to
+// keep to maxChapters, and none starts within minLength of the end. A single
+// chapter isn't worth having, so if there'd only be one there are none.
+func Propose(sceneTimes []float64, duration, minLength float64, maxChapters int) []Chapter {
+	if duration <= 0 {
+		return []Chapter{}
+	}
+	gap := max(minLength, duration/float64(maxChapters))
+
+	proposed := []Chapter{{Start: 0}}
+	last := 0.0
+	for _, t := range sceneTimes {
+		if t-last < gap || duration-t < gap {
+			continue
+		}
+		proposed = append(proposed, Chapter{Start: t})
+		last = t
+	}
+	if len(proposed) < 2 {
+		return []Chapter{}
+	}
+	for i := range proposed {
+		proposed[i].Title = fmt.Sprintf("Chapter %d", i+1)
+	}
+	return proposed
+}
+
+// WebVTT renders chapters as a WebVTT chapters track. chapters must be in
+// order of start time.
+func WebVTT(chapters []Chapter, duration float64) []byte {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n")
+	for i, chapter := range chapters {
+		end := chapterEnd(chapters, i, duration)
+		if end <= chapter.Start {
+			continue
+		}
+		fmt.Fprintf(&b, "\n%d\n%s --> %s\n%s\n",
+			i+1,
+			captions.FormatTimestamp(seconds(chapter.Start)),
+			captions.FormatTimestamp(seconds(end)),
+			cueText(chapter.Title))
+	}
+	return []byte(b.String())
+}
+
+// FFMetadata renders chapters in ffmpeg's metadata file format, for muxing
+// into an MP4 with -map_chapters. chapters must be in order of start time.
+func FFMetadata(chapters []Chapter, duration float64) []byte {
+	var b strings.Builder
+	b.WriteString(";FFMETADATA1\n")
+	for i, chapter := range chapters {
+		end := chapterEnd(chapters, i, duration)
+		if end <= chapter.Start {
+			continue
+		}
+		fmt.Fprintf(&b, "\n[CHAPTER]\nTIMEBASE=1/1000\nSTART=%d\nEND=%d\ntitle=%s\n",
+			milliseconds(chapter.Start),
+			milliseconds(end),
+			escapeMetadata(chapter.Title))
+	}
+	return []byte(b.String())
+}
+
+// cueText flattens a title onto one line, as a blank line would end the cue
+// early, and breaks up any arrow that would be read as timings.
+func cueText(title string) string {
+	return strings.ReplaceAll(strings.Join(strings.Fields(title), " "), "-->", "->")
+}
+
+func chapterEnd(chapters []Chapter, i int, duration float64) float64 {
+	if i+1 < len(chapters) {
+		return min(chapters[i+1].Start, duration)
+	}
+	return duration
+}
+
+var metadataEscaper = strings.NewReplacer(`\`, `\\`, "=", `\=`, ";", `\;`, "#", `\#`, "\n", `\`+"\n")
+
+func escapeMetadata(s string) string {
+	return metadataEscaper.Replace(s)
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Round(s * float64(time.Second)))
+}
+
+func milliseconds(s float64) int64 {
+	return int64(math.Round(s * 1000))
+}
@@ -0,0 +1,81 @@
+package chapters
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSceneTimes(t *testing.T) {
+	output := `[Parsed_showinfo_1 @ 0x55d] n:   0 pts:  62976 pts_time:4.1      duration:512 fmt:yuv420p
+[Parsed_showinfo_1 @ 0x55d] n:   1 pts: 405504 pts_time:26.4     duration:512 fmt:yuv420p
+frame=    2 fps=0.0 q=-0.0 Lsize=N/A time=00:00:26.40
+[Parsed_showinfo_1 @ 0x55d] n:   2 pts: 135168 pts_time:8.8      duration:512 fmt:yuv420p
+`
+	expected := []float64{4.1, 8.8, 26.4}
+	if result := ParseSceneTimes([]byte(output)); !reflect.DeepEqual(result, expected) {
+		t.Errorf("ParseSceneTimes() = %v; want %v", result, expected)
+	}
+	if result := ParseSceneTimes(nil); len(result) != 0 {
+		t.Errorf("ParseSceneTimes(nil) = %v; want none", result)
+	}
+}
+
+func TestPropose(t *testing.T) {
+	tests := []struct {
+		name        string
+		scenes      []float64
+		duration    float64
+		maxChapters int
+		expected    []float64
+	}{
+		{"no scenes", nil, 600, 20, []float64{}},
+		{"spaced", []float64{10, 40, 50, 95, 130}, 600, 20, []float64{0, 40, 95, 130}},
+		{"too near the end", []float64{100, 590}, 600, 20, []float64{0, 100}},
+		{"capped", []float64{30, 60, 90, 120, 150}, 200, 4, []float64{0, 60, 120}},
+		{"no duration", []float64{10}, 0, 20, []float64{}},
+	}
+
+	for _, tt := range tests {
+		result := Propose(tt.scenes, tt.duration, 30, tt.maxChapters)
+		starts := []float64{}
+		for i, chapter := range result {
+			starts = append(starts, chapter.Start)
+			if chapter.Title == "" {
+				t.Errorf("%s: chapter %d has no title", tt.name, i)
+			}
+		}
+		if !reflect.DeepEqual(starts, tt.expected) {
+			t.Errorf("%s: Propose() starts = %v; want %v", tt.name, starts, tt.expected)
+		}
+	}
+}
+
+func TestWebVTT(t *testing.T) {
+	chapters := []Chapter{
+		{Start: 0, Title: "Intro"},
+		{Start: 65.5, Title: "Main\n\npart --> end"},
+	}
+	expected := "WEBVTT\n" +
+		"\n1\n00:00:00.000 --> 00:01:05.500\nIntro\n" +
+		"\n2\n00:01:05.500 --> 00:02:00.000\nMain part -> end\n"
+
+	if result := string(WebVTT(chapters, 120)); result != expected {
+		t.Errorf("WebVTT() = %q; want %q", result, expected)
+	}
+}
+
+func TestFFMetadata(t *testing.T) {
+	chapters := []Chapter{
+		{Start: 0, Title: "A=B; #1"},
+		{Start: 12.345, Title: `back\slash`},
+		// Past the end, so dropped
+		{Start: 200, Title: "Gone"},
+	}
+	expected := ";FFMETADATA1\n" +
+		"\n[CHAPTER]\nTIMEBASE=1/1000\nSTART=0\nEND=12345\ntitle=" + `A\=B\; \#1` + "\n" +
+		"\n[CHAPTER]\nTIMEBASE=1/1000\nSTART=12345\nEND=100000\ntitle=" + `back\\slash` + "\n"
+
+	if result := string(FFMetadata(chapters, 100)); result != expected {
+		t.Errorf("FFMetadata() = %q; want %q", result, expected)
+	}
+}
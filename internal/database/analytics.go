@@ -0,0 +1,255 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type PlaybackEventType string
+
+const (
+	PlaybackEventPlay     PlaybackEventType = "play"
+	PlaybackEventProgress PlaybackEventType = "progress"
+	PlaybackEventComplete PlaybackEventType = "complete"
+)
+
+func (t PlaybackEventType) Valid() bool {
+	switch t {
+	case PlaybackEventPlay, PlaybackEventProgress, PlaybackEventComplete:
+		return true
+	default:
+		return false
+	}
+}
+
+// Largest forward jump in position between two events of a session that is
+// credited as watch time. Anything bigger is treated as a seek.
+const maxWatchTimeDelta = 60.0
+
+// Days are bucketed in UTC
+const statsDayFormat = "2006-01-02"
+
+type PlaybackEvent struct {
+	VideoID   uuid.UUID
+	SessionID string
+	// Identifies the viewer across sessions for unique viewer counts
+	ViewerKey string
+	Type      PlaybackEventType
+	Position  float64
+	// Length of the video, if known, used to work out completion
+	Duration *float64
+	At       time.Time
+}
+
+type VideoDailyStats struct {
+	Day               string  `json:"day"`
+	Views             int     `json:"views"`
+	UniqueViewers     int     `json:"unique_viewers"`
+	WatchSeconds      float64 `json:"watch_seconds"`
+	AverageCompletion float64 `json:"average_completion"`
+}
+
+type VideoStats struct {
+	Views             int               `json:"views"`
+	UniqueViewers     int               `json:"unique_viewers"`
+	WatchSeconds      float64           `json:"watch_seconds"`
+	AverageCompletion float64           `json:"average_completion"`
+	Daily             []VideoDailyStats `json:"daily"`
+}
+
+// RecordPlaybackEvent folds a single beacon into the daily counters. A play
+// event opens a session and counts a view; progress and complete events
+// credit watch time and completion to the day the session started. Events
+// for sessions that were never opened are ignored.
+func (c Client) RecordPlaybackEvent(event PlaybackEvent) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if event.Type == PlaybackEventPlay {
+		err = startPlaybackSession(tx, event)
+	} else {
+		err = updatePlaybackSession(tx, event)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func startPlaybackSession(tx *sql.Tx, event PlaybackEvent) error {
+	day := event.At.UTC().Format(statsDayFormat)
+
+	result, err := tx.Exec(`
+	INSERT OR IGNORE INTO playback_sessions (
+		video_id,
+		session_id,
+		viewer_key,
+		day,
+		last_position,
+		max_position,
+		created_at,
+		updated_at
+	) VALUES (?, ?, ?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+	`, event.VideoID, event.SessionID, event.ViewerKey, day, event.Position, event.Position)
+	if err != nil {
+		return err
+	}
+	// A replayed play beacon for the same session isn't another view
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		return err
+	}
+
+	result, err = tx.Exec(`
+	INSERT OR IGNORE INTO video_daily_viewers (video_id, day, viewer_key)
+	VALUES (?, ?, ?)
+	`, event.VideoID, day, event.ViewerKey)
+	if err != nil {
+		return err
+	}
+	newViewer, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	return addDailyStats(tx, event.VideoID, day, 1, int(newViewer), 0, completionDelta(0, event.Position, event.Duration))
+}
+
+func updatePlaybackSession(tx *sql.Tx, event PlaybackEvent) error {
+	var day string
+	var lastPosition, maxPosition float64
+	err := tx.QueryRow(`
+	SELECT day, last_position, max_position
+	FROM playback_sessions
+	WHERE video_id = ? AND session_id = ?
+	`, event.VideoID, event.SessionID).Scan(&day, &lastPosition, &maxPosition)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+
+	watched := 0.0
+	if delta := event.Position - lastPosition; delta > 0 && delta <= maxWatchTimeDelta {
+		watched = delta
+	}
+
+	newMaxPosition := max(maxPosition, event.Position)
+	if event.Type == PlaybackEventComplete && event.Duration != nil {
+		newMaxPosition = max(newMaxPosition, *event.Duration)
+	}
+
+	_, err = tx.Exec(`
+	UPDATE playback_sessions
+	SET last_position = ?, max_position = ?, updated_at = CURRENT_TIMESTAMP
+	WHERE video_id = ? AND session_id = ?
+	`, event.Position, newMaxPosition, event.VideoID, event.SessionID)
+	if err != nil {
+		return err
+	}
+
+	return addDailyStats(tx, event.VideoID, day, 0, 0, watched, completionDelta(maxPosition, newMaxPosition, event.Duration))
+}
+
+// completionDelta is how much further through the video (as a fraction) a
+// session got by advancing its furthest position from oldMax to newMax.
+func completionDelta(oldMax, newMax float64, duration *float64) float64 {
+	if duration == nil || *duration <= 0 {
+		return 0
+	}
+	return (min(newMax, *duration) - min(oldMax, *duration)) / *duration
+}
+
+func addDailyStats(tx *sql.Tx, videoID uuid.UUID, day string, views, uniqueViewers int, watchSeconds, completion float64) error {
+	_, err := tx.Exec(`
+	INSERT INTO video_daily_stats (
+		video_id,
+		day,
+		views,
+		unique_viewers,
+		watch_seconds,
+		completion_sum
+	) VALUES (?, ?, ?, ?, ?, ?)
+	ON CONFLICT(video_id, day) DO UPDATE SET
+		views = views + excluded.views,
+		unique_viewers = unique_viewers + excluded.unique_viewers,
+		watch_seconds = watch_seconds + excluded.watch_seconds,
+		completion_sum = completion_sum + excluded.completion_sum
+	`, videoID, day, views, uniqueViewers, watchSeconds, completion)
+	return err
+}
+
+// GetVideoStats summarises the days from..to inclusive. Unique viewers in the
+// totals are distinct across the whole range, not a sum of the daily figures.
+func (c Client) GetVideoStats(videoID uuid.UUID, from, to time.Time) (VideoStats, error) {
+	fromDay := from.UTC().Format(statsDayFormat)
+	toDay := to.UTC().Format(statsDayFormat)
+
+	rows, err := c.db.Query(`
+	SELECT day, views, unique_viewers, watch_seconds, completion_sum
+	FROM video_daily_stats
+	WHERE video_id = ? AND day >= ? AND day <= ?
+	ORDER BY day
+	`, videoID, fromDay, toDay)
+	if err != nil {
+		return VideoStats{}, err
+	}
+	defer rows.Close()
+
+	stats := VideoStats{Daily: []VideoDailyStats{}}
+	completionSum := 0.0
+	for rows.Next() {
+		var daily VideoDailyStats
+		var dailyCompletionSum float64
+		if err := rows.Scan(&daily.Day, &daily.Views, &daily.UniqueViewers, &daily.WatchSeconds, &dailyCompletionSum); err != nil {
+			return VideoStats{}, err
+		}
+		if daily.Views > 0 {
+			daily.AverageCompletion = roundCompletion(dailyCompletionSum / float64(daily.Views))
+		}
+		stats.Views += daily.Views
+		stats.WatchSeconds += daily.WatchSeconds
+		completionSum += dailyCompletionSum
+		stats.Daily = append(stats.Daily, daily)
+	}
+	if err := rows.Err(); err != nil {
+		return VideoStats{}, err
+	}
+	if stats.Views > 0 {
+		stats.AverageCompletion = roundCompletion(completionSum / float64(stats.Views))
+	}
+
+	err = c.db.QueryRow(`
+	SELECT COUNT(DISTINCT viewer_key)
+	FROM video_daily_viewers
+	WHERE video_id = ? AND day >= ? AND day <= ?
+	`, videoID, fromDay, toDay).Scan(&stats.UniqueViewers)
+	if err != nil {
+		return VideoStats{}, err
+	}
+
+	return stats, nil
+}
+
+// roundCompletion hides the float error accumulated from summing many small
+// completion deltas.
+func roundCompletion(completion float64) float64 {
+	return math.Round(completion*1e4) / 1e4
+}
+
+func deleteVideoAnalytics(db execer, videoID uuid.UUID) error {
+	for _, table := range []string{"playback_sessions", "video_daily_viewers", "video_daily_stats"} {
+		_, err := db.Exec("DELETE FROM "+table+" WHERE video_id = ?", videoID)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
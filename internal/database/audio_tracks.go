@@ -0,0 +1,73 @@
+package database
+
+import (
+	"encoding/json"
+
+	"github.com/google/uuid"
+)
+
+// AudioTrack describes one of the audio streams in a version's media, in the
+// order players list them.
+type AudioTrack struct {
+	Position int    `json:"position"`
+	Language string `json:"language"`
+	Label    string `json:"label"`
+	Codec    string `json:"codec"`
+	Channels int    `json:"channels"`
+	Default  bool   `json:"default"`
+}
+
+// Audio tracks of the active version for videoColumns, as a JSON array in
+// stream order
+const videoAudioTracksColumn = `
+		(
+			SELECT json_group_array(json_object(
+				'position', position,
+				'language', language,
+				'label', label,
+				'codec', codec,
+				'channels', channels,
+				'default', json(CASE WHEN is_default THEN 'true' ELSE 'false' END)
+			))
+			FROM (
+				SELECT *
+				FROM version_audio_tracks
+				WHERE version_audio_tracks.version_id = videos.active_version_id
+				ORDER BY position
+			)
+		)`
+
+func parseAudioTracks(tracks *string) ([]AudioTrack, error) {
+	audioTracks := []AudioTrack{}
+	if tracks == nil {
+		return audioTracks, nil
+	}
+	err := json.Unmarshal([]byte(*tracks), &audioTracks)
+	return audioTracks, err
+}
+
+// SetVersionAudioTracks replaces the audio tracks recorded for a version's
+// media.
+func (c Client) SetVersionAudioTracks(versionID uuid.UUID, tracks []AudioTrack) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM version_audio_tracks WHERE version_id = ?", versionID)
+	if err != nil {
+		return err
+	}
+	for _, track := range tracks {
+		_, err = tx.Exec(`
+		INSERT INTO version_audio_tracks (version_id, position, language, label, codec, channels, is_default)
+		VALUES (?, ?, ?, ?, ?, ?, ?)
+		`, versionID, track.Position, track.Language, track.Label, track.Codec, track.Channels, track.Default)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
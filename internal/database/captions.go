@@ -0,0 +1,152 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+type CaptionSource string
+
+const (
+	// Uploaded by the owner
+	CaptionSourceUpload CaptionSource = "upload"
+	// Extracted from a subtitle stream in the active version's media
+	CaptionSourceEmbedded CaptionSource = "embedded"
+)
+
+// CaptionTrack is a WebVTT file of captions in one language.
+type CaptionTrack struct {
+	Language string        `json:"language"`
+	Label    string        `json:"label"`
+	URL      string        `json:"url"`
+	Source   CaptionSource `json:"source"`
+}
+
+// Caption tracks for videoColumns, as a JSON array ordered by language. The
+// owner's tracks belong to the video and take precedence over those extracted
+// from the active version in the same language.
+const videoCaptionsColumn = `
+		(
+			SELECT json_group_array(json_object('language', language, 'label', label, 'url', url, 'source', source))
+			FROM (
+				SELECT language, label, url, source
+				FROM caption_tracks
+				WHERE caption_tracks.video_id = videos.id
+				UNION ALL
+				SELECT language, label, url, 'embedded'
+				FROM version_caption_tracks
+				WHERE version_caption_tracks.version_id = videos.active_version_id
+					AND language NOT IN (SELECT language FROM caption_tracks WHERE caption_tracks.video_id = videos.id)
+				ORDER BY language
+			)
+		)`
+
+func parseCaptionTracks(tracks *string) ([]CaptionTrack, error) {
+	captions := []CaptionTrack{}
+	if tracks == nil {
+		return captions, nil
+	}
+	err := json.Unmarshal([]byte(*tracks), &captions)
+	return captions, err
+}
+
+// SetCaptionTrack adds the owner's track for track.Language, replacing any
+// there already.
+func (c Client) SetCaptionTrack(videoID uuid.UUID, track CaptionTrack) error {
+	query := `
+	INSERT INTO caption_tracks (video_id, language, label, url, source, created_at)
+	VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+	ON CONFLICT(video_id, language) DO UPDATE SET
+		label = excluded.label,
+		url = excluded.url,
+		source = excluded.source,
+		created_at = excluded.created_at
+	`
+	_, err := c.db.Exec(query, videoID, track.Language, track.Label, track.URL, track.Source)
+	return err
+}
+
+// SetVersionCaptionTracks replaces the caption tracks extracted from a
+// version's media.
+func (c Client) SetVersionCaptionTracks(versionID uuid.UUID, tracks []CaptionTrack) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM version_caption_tracks WHERE version_id = ?", versionID)
+	if err != nil {
+		return err
+	}
+	for _, track := range tracks {
+		_, err = tx.Exec(`
+		INSERT INTO version_caption_tracks (version_id, language, label, url, created_at)
+		VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+		`, versionID, track.Language, track.Label, track.URL)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// GetVersionCaptionTrack returns the caption track extracted from a version's
+// media for the language, or a zero track if there isn't one.
+func (c Client) GetVersionCaptionTrack(versionID uuid.UUID, language string) (CaptionTrack, error) {
+	query := `
+	SELECT language, label, url
+	FROM version_caption_tracks
+	WHERE version_id = ? AND language = ?
+	`
+	track := CaptionTrack{Source: CaptionSourceEmbedded}
+	err := c.db.QueryRow(query, versionID, language).Scan(&track.Language, &track.Label, &track.URL)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return CaptionTrack{}, nil
+		}
+		return CaptionTrack{}, err
+	}
+
+	return track, nil
+}
+
+func (c Client) DeleteVersionCaptionTrack(versionID uuid.UUID, language string) error {
+	query := `
+	DELETE FROM version_caption_tracks
+	WHERE version_id = ? AND language = ?
+	`
+	_, err := c.db.Exec(query, versionID, language)
+	return err
+}
+
+func (c Client) GetCaptionTrack(videoID uuid.UUID, language string) (CaptionTrack, error) {
+	query := `
+	SELECT language, label, url, source
+	FROM caption_tracks
+	WHERE video_id = ? AND language = ?
+	`
+	var track CaptionTrack
+	err := c.db.QueryRow(query, videoID, language).Scan(&track.Language, &track.Label, &track.URL, &track.Source)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return CaptionTrack{}, nil
+		}
+		return CaptionTrack{}, err
+	}
+
+	return track, nil
+}
+
+func (c Client) DeleteCaptionTrack(videoID uuid.UUID, language string) error {
+	query := `
+	DELETE FROM caption_tracks
+	WHERE video_id = ? AND language = ?
+	`
+	_, err := c.db.Exec(query, videoID, language)
+	return err
+}
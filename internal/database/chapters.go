@@ -0,0 +1,118 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+type ChapterSource string
+
+const (
+	// Proposed from scene changes when the video was processed
+	ChapterSourceDetected ChapterSource = "detected"
+	// Set by the owner
+	ChapterSourceOwner ChapterSource = "owner"
+)
+
+// Chapter is a titled section of a video, running until the next chapter
+// starts.
+type Chapter struct {
+	// Seconds from the start of the video
+	Start        float64       `json:"start"`
+	Title        string        `json:"title"`
+	ThumbnailURL *string       `json:"thumbnail_url"`
+	Source       ChapterSource `json:"source"`
+}
+
+// Chapters for videoColumns, as a JSON array in order of start time
+const videoChaptersColumn = `
+		(
+			SELECT json_group_array(json_object('start', start_time, 'title', title, 'thumbnail_url', thumbnail_url, 'source', source))
+			FROM (
+				SELECT start_time, title, thumbnail_url, source
+				FROM chapters
+				WHERE chapters.video_id = videos.id
+				ORDER BY start_time
+			)
+		)`
+
+func parseChapters(chapters *string) ([]Chapter, error) {
+	videoChapters := []Chapter{}
+	if chapters == nil {
+		return videoChapters, nil
+	}
+	err := json.Unmarshal([]byte(*chapters), &videoChapters)
+	return videoChapters, err
+}
+
+// SetChapters replaces the video's chapters with ones set by the owner,
+// returning the old chapters so thumbnails no longer used can be deleted.
+func (c Client) SetChapters(videoID uuid.UUID, chapters []Chapter) ([]Chapter, error) {
+	return c.replaceChapters(videoID, chapters, ChapterSourceOwner, false)
+}
+
+// ReplaceDetectedChapters swaps chapters proposed for the video's previous
+// upload for those proposed for a new one, returning the old chapters. If the
+// owner has set chapters of their own, they're kept and ok is false.
+func (c Client) ReplaceDetectedChapters(videoID uuid.UUID, chapters []Chapter) (removed []Chapter, ok bool, err error) {
+	removed, err = c.replaceChapters(videoID, chapters, ChapterSourceDetected, true)
+	if errors.Is(err, errChaptersEdited) {
+		return nil, false, nil
+	}
+	return removed, err == nil, err
+}
+
+var errChaptersEdited = errors.New("chapters have been set by the owner")
+
+func (c Client) replaceChapters(videoID uuid.UUID, chapters []Chapter, source ChapterSource, keepOwnerChapters bool) ([]Chapter, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`
+	SELECT start_time, title, thumbnail_url, source
+	FROM chapters
+	WHERE video_id = ?
+	ORDER BY start_time
+	`, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	removed := []Chapter{}
+	for rows.Next() {
+		var chapter Chapter
+		if err := rows.Scan(&chapter.Start, &chapter.Title, &chapter.ThumbnailURL, &chapter.Source); err != nil {
+			return nil, err
+		}
+		if keepOwnerChapters && chapter.Source == ChapterSourceOwner {
+			return nil, errChaptersEdited
+		}
+		removed = append(removed, chapter)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	_, err = tx.Exec("DELETE FROM chapters WHERE video_id = ?", videoID)
+	if err != nil {
+		return nil, err
+	}
+	for _, chapter := range chapters {
+		_, err = tx.Exec(`
+		INSERT INTO chapters (video_id, start_time, title, thumbnail_url, source, created_at)
+		VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+		`, videoID, chapter.Start, chapter.Title, chapter.ThumbnailURL, source)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return removed, tx.Commit()
+}
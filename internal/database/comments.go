@@ -0,0 +1,353 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Comment struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	// Hidden comments are only shown to the owner of the video
+	Hidden bool `json:"hidden"`
+	// Top level comments carry their first replies; the rest are paged
+	// through with GetReplies
+	Replies    []Comment `json:"replies,omitempty"`
+	ReplyCount int       `json:"reply_count"`
+	CreateCommentParams
+}
+
+type CreateCommentParams struct {
+	VideoID uuid.UUID `json:"video_id"`
+	UserID  uuid.UUID `json:"user_id"`
+	// Replies point at a top level comment; replies to replies aren't allowed
+	ParentID *uuid.UUID `json:"parent_id"`
+	Body     string     `json:"body"`
+}
+
+type GetCommentsParams struct {
+	VideoID       uuid.UUID
+	Limit         int
+	Cursor        string
+	IncludeHidden bool
+}
+
+type GetRepliesParams struct {
+	ParentID      uuid.UUID
+	Limit         int
+	Cursor        string
+	IncludeHidden bool
+}
+
+type CommentPage struct {
+	Comments   []Comment `json:"comments"`
+	NextCursor string    `json:"next_cursor,omitempty"`
+}
+
+const commentColumns = `
+		id,
+		created_at,
+		updated_at,
+		hidden,
+		video_id,
+		user_id,
+		parent_id,
+		body`
+
+// scanComment scans the commentColumns, followed by any extra columns the
+// query selected into extra.
+func scanComment(row rowScanner, extra ...any) (Comment, error) {
+	var comment Comment
+	dest := []any{
+		&comment.ID,
+		&comment.CreatedAt,
+		&comment.UpdatedAt,
+		&comment.Hidden,
+		&comment.VideoID,
+		&comment.UserID,
+		&comment.ParentID,
+		&comment.Body,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	return comment, err
+}
+
+// Top level comments come with at most this many of their replies, oldest
+// first
+const maxInlineReplies = 3
+
+type commentCursor struct {
+	CreatedAt string    `json:"c"`
+	ID        uuid.UUID `json:"id"`
+}
+
+func (c Client) CreateComment(params CreateCommentParams) (Comment, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO comments (
+		id,
+		created_at,
+		updated_at,
+		video_id,
+		user_id,
+		parent_id,
+		body
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?)
+	`
+	_, err := c.db.Exec(query, id, params.VideoID, params.UserID, params.ParentID, params.Body)
+	if err != nil {
+		return Comment{}, err
+	}
+
+	return c.GetComment(id)
+}
+
+func (c Client) GetComment(id uuid.UUID) (Comment, error) {
+	query := `
+	SELECT` + commentColumns + `
+	FROM comments
+	WHERE id = ?
+	`
+	comment, err := scanComment(c.db.QueryRow(query, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Comment{}, nil
+		}
+		return Comment{}, err
+	}
+
+	return comment, nil
+}
+
+// GetComments pages through a video's top level comments, newest first, with
+// each one's first few replies attached.
+func (c Client) GetComments(params GetCommentsParams) (CommentPage, error) {
+	conditions := []string{"video_id = ?", "parent_id IS NULL"}
+	args := []any{params.VideoID}
+	if !params.IncludeHidden {
+		conditions = append(conditions, "hidden = 0")
+	}
+	if params.Cursor != "" {
+		cursor, err := decodeCommentCursor(params.Cursor)
+		if err != nil {
+			return CommentPage{}, err
+		}
+		conditions = append(conditions, "(created_at < ? OR (created_at = ? AND id < ?))")
+		args = append(args, cursor.CreatedAt, cursor.CreatedAt, cursor.ID)
+	}
+
+	query := `
+	SELECT` + commentColumns + `
+	FROM comments
+	WHERE ` + strings.Join(conditions, " AND ") + `
+	ORDER BY created_at DESC, id DESC
+	LIMIT ?
+	`
+	args = append(args, params.Limit+1)
+
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return CommentPage{}, err
+	}
+	defer rows.Close()
+
+	page := CommentPage{Comments: []Comment{}}
+	for rows.Next() {
+		comment, err := scanComment(rows)
+		if err != nil {
+			return CommentPage{}, err
+		}
+		page.Comments = append(page.Comments, comment)
+	}
+	if err := rows.Err(); err != nil {
+		return CommentPage{}, err
+	}
+	rows.Close()
+
+	if len(page.Comments) > params.Limit {
+		page.Comments = page.Comments[:params.Limit]
+		last := page.Comments[len(page.Comments)-1]
+		page.NextCursor, err = encodeCommentCursor(commentCursor{
+			CreatedAt: last.CreatedAt.UTC().Format(sqliteTimestampFormat),
+			ID:        last.ID,
+		})
+		if err != nil {
+			return CommentPage{}, err
+		}
+	}
+
+	err = c.attachReplies(page.Comments, params.IncludeHidden)
+	if err != nil {
+		return CommentPage{}, err
+	}
+
+	return page, nil
+}
+
+// attachReplies fills in the first replies and the reply count of each of the
+// comments, fetching them all in one query.
+func (c Client) attachReplies(comments []Comment, includeHidden bool) error {
+	if len(comments) == 0 {
+		return nil
+	}
+	byID := map[uuid.UUID]*Comment{}
+	placeholders := []string{}
+	args := []any{}
+	for i := range comments {
+		comments[i].Replies = []Comment{}
+		byID[comments[i].ID] = &comments[i]
+		placeholders = append(placeholders, "?")
+		args = append(args, comments[i].ID)
+	}
+
+	conditions := []string{"parent_id IN (" + strings.Join(placeholders, ", ") + ")"}
+	if !includeHidden {
+		conditions = append(conditions, "hidden = 0")
+	}
+	query := `
+	SELECT` + commentColumns + `, reply_count
+	FROM (
+		SELECT` + commentColumns + `,
+			ROW_NUMBER() OVER (PARTITION BY parent_id ORDER BY created_at, id) AS position,
+			COUNT(*) OVER (PARTITION BY parent_id) AS reply_count
+		FROM comments
+		WHERE ` + strings.Join(conditions, " AND ") + `
+	)
+	WHERE position <= ?
+	ORDER BY parent_id, position
+	`
+	args = append(args, maxInlineReplies)
+
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var replyCount int
+		reply, err := scanComment(rows, &replyCount)
+		if err != nil {
+			return err
+		}
+		parent := byID[*reply.ParentID]
+		parent.Replies = append(parent.Replies, reply)
+		parent.ReplyCount = replyCount
+	}
+	return rows.Err()
+}
+
+// GetReplies pages through the replies to a comment, oldest first.
+func (c Client) GetReplies(params GetRepliesParams) (CommentPage, error) {
+	conditions := []string{"parent_id = ?"}
+	args := []any{params.ParentID}
+	if !params.IncludeHidden {
+		conditions = append(conditions, "hidden = 0")
+	}
+	if params.Cursor != "" {
+		cursor, err := decodeCommentCursor(params.Cursor)
+		if err != nil {
+			return CommentPage{}, err
+		}
+		conditions = append(conditions, "(created_at > ? OR (created_at = ? AND id > ?))")
+		args = append(args, cursor.CreatedAt, cursor.CreatedAt, cursor.ID)
+	}
+
+	query := `
+	SELECT` + commentColumns + `
+	FROM comments
+	WHERE ` + strings.Join(conditions, " AND ") + `
+	ORDER BY created_at, id
+	LIMIT ?
+	`
+	args = append(args, params.Limit+1)
+
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return CommentPage{}, err
+	}
+	defer rows.Close()
+
+	page := CommentPage{Comments: []Comment{}}
+	for rows.Next() {
+		reply, err := scanComment(rows)
+		if err != nil {
+			return CommentPage{}, err
+		}
+		page.Comments = append(page.Comments, reply)
+	}
+	if err := rows.Err(); err != nil {
+		return CommentPage{}, err
+	}
+
+	if len(page.Comments) > params.Limit {
+		page.Comments = page.Comments[:params.Limit]
+		last := page.Comments[len(page.Comments)-1]
+		page.NextCursor, err = encodeCommentCursor(commentCursor{
+			CreatedAt: last.CreatedAt.UTC().Format(sqliteTimestampFormat),
+			ID:        last.ID,
+		})
+		if err != nil {
+			return CommentPage{}, err
+		}
+	}
+
+	return page, nil
+}
+
+func (c Client) UpdateCommentBody(id uuid.UUID, body string) error {
+	query := `
+	UPDATE comments
+	SET body = ?, updated_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, body, id)
+	return err
+}
+
+func (c Client) SetCommentHidden(id uuid.UUID, hidden bool) error {
+	query := `
+	UPDATE comments
+	SET hidden = ?
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, hidden, id)
+	return err
+}
+
+// DeleteComment also deletes any replies to the comment.
+func (c Client) DeleteComment(id uuid.UUID) error {
+	query := `
+	DELETE FROM comments
+	WHERE id = ? OR parent_id = ?
+	`
+	_, err := c.db.Exec(query, id, id)
+	return err
+}
+
+func encodeCommentCursor(cursor commentCursor) (string, error) {
+	dat, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(dat), nil
+}
+
+func decodeCommentCursor(s string) (commentCursor, error) {
+	dat, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return commentCursor{}, ErrInvalidCursor
+	}
+	var cursor commentCursor
+	if err := json.Unmarshal(dat, &cursor); err != nil {
+		return commentCursor{}, ErrInvalidCursor
+	}
+	return cursor, nil
+}
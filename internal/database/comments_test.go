@@ -0,0 +1,81 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestGetCommentsReplies(t *testing.T) {
+	db, err := NewClient(filepath.Join(t.TempDir(), "tubely.db"))
+	if err != nil {
+		t.Fatalf("NewClient() error: %v", err)
+	}
+	user, err := db.CreateUser(CreateUserParams{Email: "owner@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatalf("CreateUser() error: %v", err)
+	}
+	videoID := createVideo(t, db, user.ID)
+
+	createComment := func(parentID *uuid.UUID) Comment {
+		t.Helper()
+		comment, err := db.CreateComment(CreateCommentParams{VideoID: videoID, UserID: user.ID, ParentID: parentID, Body: "Nice"})
+		if err != nil {
+			t.Fatalf("CreateComment() error: %v", err)
+		}
+		return comment
+	}
+	busy := createComment(nil)
+	quiet := createComment(nil)
+	for range maxInlineReplies + 2 {
+		createComment(&busy.ID)
+	}
+	hidden := createComment(&quiet.ID)
+	if err := db.SetCommentHidden(hidden.ID, true); err != nil {
+		t.Fatalf("SetCommentHidden() error: %v", err)
+	}
+
+	page, err := db.GetComments(GetCommentsParams{VideoID: videoID, Limit: 10})
+	if err != nil {
+		t.Fatalf("GetComments() error: %v", err)
+	}
+	replies := map[uuid.UUID]Comment{}
+	for _, comment := range page.Comments {
+		replies[comment.ID] = comment
+	}
+	if got := replies[busy.ID]; len(got.Replies) != maxInlineReplies || got.ReplyCount != maxInlineReplies+2 {
+		t.Errorf("busy comment has %d of %d replies; want %d of %d", len(got.Replies), got.ReplyCount, maxInlineReplies, maxInlineReplies+2)
+	}
+	if got := replies[quiet.ID]; len(got.Replies) != 0 || got.ReplyCount != 0 {
+		t.Errorf("quiet comment has %d of %d replies; want its hidden reply left out", len(got.Replies), got.ReplyCount)
+	}
+
+	// Paging through the replies returns each of them once, in order
+	seen := map[uuid.UUID]bool{}
+	var previous *Comment
+	params := GetRepliesParams{ParentID: busy.ID, Limit: 2}
+	for {
+		page, err := db.GetReplies(params)
+		if err != nil {
+			t.Fatalf("GetReplies() error: %v", err)
+		}
+		for _, reply := range page.Comments {
+			if seen[reply.ID] {
+				t.Errorf("reply %s returned twice", reply.ID)
+			}
+			seen[reply.ID] = true
+			if previous != nil && reply.CreatedAt.Equal(previous.CreatedAt) && reply.ID.String() < previous.ID.String() {
+				t.Errorf("replies out of order")
+			}
+			previous = &reply
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		params.Cursor = page.NextCursor
+	}
+	if len(seen) != maxInlineReplies+2 {
+		t.Errorf("paged through %d replies; want %d", len(seen), maxInlineReplies+2)
+	}
+}
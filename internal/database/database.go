@@ -3,7 +3,10 @@ package database
 import (
 	"database/sql"
 	"fmt"
+	"net/url"
+	"strings"
 
+	"github.com/google/uuid"
 	_ "github.com/mattn/go-sqlite3"
 )
 
@@ -11,6 +14,11 @@ type Client struct {
 	db *sql.DB
 }
 
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
 func NewClient(pathToDB string) (Client, error) {
 	db, err := sql.Open("sqlite3", pathToDB)
 	if err != nil {
@@ -72,16 +80,596 @@ func (c *Client) autoMigrate() error {
 	if err != nil {
 		return err
 	}
+	err = c.migrateVideoColumns()
+	if err != nil {
+		return err
+	}
+
+	shareLinkTable := `
+	CREATE TABLE IF NOT EXISTS share_links (
+		token TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		video_id TEXT NOT NULL,
+		expires_at TIMESTAMP NOT NULL,
+		max_views INTEGER,
+		view_count INTEGER NOT NULL DEFAULT 0,
+		password TEXT,
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.db.Exec(shareLinkTable)
+	if err != nil {
+		return err
+	}
+
+	tagTables := `
+	CREATE TABLE IF NOT EXISTS tags (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		user_id TEXT NOT NULL,
+		name TEXT NOT NULL,
+		UNIQUE(user_id, name),
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	CREATE TABLE IF NOT EXISTS video_tags (
+		video_id TEXT NOT NULL,
+		tag_id TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY(video_id, tag_id),
+		FOREIGN KEY(video_id) REFERENCES videos(id),
+		FOREIGN KEY(tag_id) REFERENCES tags(id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_video_tags_tag_id ON video_tags(tag_id);
+	`
+	_, err = c.db.Exec(tagTables)
+	if err != nil {
+		return err
+	}
+
+	playlistTables := `
+	CREATE TABLE IF NOT EXISTS playlists (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		title TEXT NOT NULL,
+		description TEXT,
+		visibility TEXT NOT NULL DEFAULT 'private',
+		user_id TEXT NOT NULL,
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	CREATE TABLE IF NOT EXISTS playlist_items (
+		id TEXT PRIMARY KEY,
+		playlist_id TEXT NOT NULL,
+		video_id TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		added_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(playlist_id, video_id),
+		FOREIGN KEY(playlist_id) REFERENCES playlists(id),
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_playlist_items_video_id ON playlist_items(video_id);
+	`
+	_, err = c.db.Exec(playlistTables)
+	if err != nil {
+		return err
+	}
+
+	analyticsTables := `
+	CREATE TABLE IF NOT EXISTS playback_sessions (
+		video_id TEXT NOT NULL,
+		session_id TEXT NOT NULL,
+		viewer_key TEXT NOT NULL,
+		day TEXT NOT NULL,
+		last_position REAL NOT NULL DEFAULT 0,
+		max_position REAL NOT NULL DEFAULT 0,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY(video_id, session_id),
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	CREATE TABLE IF NOT EXISTS video_daily_viewers (
+		video_id TEXT NOT NULL,
+		day TEXT NOT NULL,
+		viewer_key TEXT NOT NULL,
+		PRIMARY KEY(video_id, day, viewer_key),
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	CREATE TABLE IF NOT EXISTS video_daily_stats (
+		video_id TEXT NOT NULL,
+		day TEXT NOT NULL,
+		views INTEGER NOT NULL DEFAULT 0,
+		unique_viewers INTEGER NOT NULL DEFAULT 0,
+		watch_seconds REAL NOT NULL DEFAULT 0,
+		completion_sum REAL NOT NULL DEFAULT 0,
+		PRIMARY KEY(video_id, day),
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.db.Exec(analyticsTables)
+	if err != nil {
+		return err
+	}
+
+	watchProgressTable := `
+	CREATE TABLE IF NOT EXISTS watch_progress (
+		user_id TEXT NOT NULL,
+		video_id TEXT NOT NULL,
+		position REAL NOT NULL,
+		completed BOOLEAN NOT NULL DEFAULT 0,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY(user_id, video_id),
+		FOREIGN KEY(user_id) REFERENCES users(id),
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_watch_progress_video_id ON watch_progress(video_id);
+	`
+	_, err = c.db.Exec(watchProgressTable)
+	if err != nil {
+		return err
+	}
+
+	commentTable := `
+	CREATE TABLE IF NOT EXISTS comments (
+		id TEXT PRIMARY KEY,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		video_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		parent_id TEXT,
+		body TEXT NOT NULL,
+		hidden BOOLEAN NOT NULL DEFAULT 0,
+		FOREIGN KEY(video_id) REFERENCES videos(id),
+		FOREIGN KEY(user_id) REFERENCES users(id),
+		FOREIGN KEY(parent_id) REFERENCES comments(id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_comments_video_id ON comments(video_id, created_at);
+	CREATE INDEX IF NOT EXISTS idx_comments_parent_id ON comments(parent_id);
+	`
+	_, err = c.db.Exec(commentTable)
+	if err != nil {
+		return err
+	}
+
+	reactionTable := `
+	CREATE TABLE IF NOT EXISTS video_reactions (
+		video_id TEXT NOT NULL,
+		user_id TEXT NOT NULL,
+		reaction TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY(video_id, user_id, reaction),
+		FOREIGN KEY(video_id) REFERENCES videos(id),
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	CREATE INDEX IF NOT EXISTS idx_video_reactions_user_id ON video_reactions(user_id, reaction, created_at);
+	`
+	_, err = c.db.Exec(reactionTable)
+	if err != nil {
+		return err
+	}
+
+	versionTable := `
+	CREATE TABLE IF NOT EXISTS video_versions (
+		id TEXT PRIMARY KEY,
+		video_id TEXT NOT NULL,
+		version INTEGER NOT NULL,
+		storage_key TEXT NOT NULL,
+		duration REAL,
+		aspect_class TEXT,
+		size_bytes INTEGER NOT NULL,
+		uploaded_by TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(video_id, version),
+		FOREIGN KEY(video_id) REFERENCES videos(id),
+		FOREIGN KEY(uploaded_by) REFERENCES users(id)
+	);
+	`
+	_, err = c.db.Exec(versionTable)
+	if err != nil {
+		return err
+	}
+	if _, err := c.addColumnIfNotExists("video_versions", "integrated_loudness", "REAL"); err != nil {
+		return err
+	}
+	if _, err := c.addColumnIfNotExists("video_versions", "true_peak", "REAL"); err != nil {
+		return err
+	}
+	if _, err := c.addColumnIfNotExists("video_versions", "media_kind", "TEXT NOT NULL DEFAULT 'video'"); err != nil {
+		return err
+	}
+	err = c.migrateLegacyVersions()
+	if err != nil {
+		return err
+	}
+
+	captionTable := `
+	CREATE TABLE IF NOT EXISTS caption_tracks (
+		video_id TEXT NOT NULL,
+		language TEXT NOT NULL,
+		label TEXT NOT NULL,
+		url TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY(video_id, language),
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.db.Exec(captionTable)
+	if err != nil {
+		return err
+	}
+	if _, err := c.addColumnIfNotExists("caption_tracks", "source", "TEXT NOT NULL DEFAULT 'upload'"); err != nil {
+		return err
+	}
+
+	chapterTable := `
+	CREATE TABLE IF NOT EXISTS chapters (
+		video_id TEXT NOT NULL,
+		start_time REAL NOT NULL,
+		title TEXT NOT NULL,
+		thumbnail_url TEXT,
+		source TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY(video_id, start_time),
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.db.Exec(chapterTable)
+	if err != nil {
+		return err
+	}
+
+	audioTrackTable := `
+	CREATE TABLE IF NOT EXISTS version_audio_tracks (
+		version_id TEXT NOT NULL,
+		position INTEGER NOT NULL,
+		language TEXT NOT NULL,
+		label TEXT NOT NULL,
+		codec TEXT NOT NULL,
+		channels INTEGER NOT NULL,
+		is_default BOOLEAN NOT NULL DEFAULT 0,
+		PRIMARY KEY(version_id, position),
+		FOREIGN KEY(version_id) REFERENCES video_versions(id)
+	);
+	`
+	_, err = c.db.Exec(audioTrackTable)
+	if err != nil {
+		return err
+	}
+
+	versionCaptionTable := `
+	CREATE TABLE IF NOT EXISTS version_caption_tracks (
+		version_id TEXT NOT NULL,
+		language TEXT NOT NULL,
+		label TEXT NOT NULL,
+		url TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY(version_id, language),
+		FOREIGN KEY(version_id) REFERENCES video_versions(id)
+	);
+	`
+	_, err = c.db.Exec(versionCaptionTable)
+	if err != nil {
+		return err
+	}
+	err = c.migrateVersionTracks()
+	if err != nil {
+		return err
+	}
+
+	assetTable := `
+	CREATE TABLE IF NOT EXISTS version_assets (
+		version_id TEXT NOT NULL,
+		kind TEXT NOT NULL,
+		url TEXT NOT NULL,
+		created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY(version_id, kind),
+		FOREIGN KEY(version_id) REFERENCES video_versions(id)
+	);
+	`
+	_, err = c.db.Exec(assetTable)
+	if err != nil {
+		return err
+	}
+
+	watermarkTable := `
+	CREATE TABLE IF NOT EXISTS watermarks (
+		user_id TEXT PRIMARY KEY,
+		url TEXT NOT NULL,
+		position TEXT NOT NULL,
+		opacity REAL NOT NULL,
+		scale REAL NOT NULL,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+	`
+	_, err = c.db.Exec(watermarkTable)
+	if err != nil {
+		return err
+	}
+
+	processingJobTable := `
+	CREATE TABLE IF NOT EXISTS processing_jobs (
+		id TEXT PRIMARY KEY,
+		video_id TEXT NOT NULL,
+		status TEXT NOT NULL,
+		stage TEXT NOT NULL,
+		percent REAL,
+		eta_seconds REAL,
+		started_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+		finished_at TIMESTAMP,
+		FOREIGN KEY(video_id) REFERENCES videos(id)
+	);
+	`
+	_, err = c.db.Exec(processingJobTable)
+	if err != nil {
+		return err
+	}
+
+	err = c.migrateSearchIndex()
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// migrateVideoColumns adds columns introduced after the videos table was
+// first created, so existing databases pick them up on startup.
+func (c *Client) migrateVideoColumns() error {
+	added, err := c.addColumnIfNotExists("videos", "status", "TEXT NOT NULL DEFAULT 'draft'")
+	if err != nil {
+		return err
+	}
+	if added {
+		_, err = c.db.Exec("UPDATE videos SET status = 'ready' WHERE video_url IS NOT NULL")
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := c.addColumnIfNotExists("videos", "duration", "REAL"); err != nil {
+		return err
+	}
+	if _, err := c.addColumnIfNotExists("videos", "aspect_class", "TEXT"); err != nil {
+		return err
+	}
+	if _, err := c.addColumnIfNotExists("videos", "comments_enabled", "BOOLEAN NOT NULL DEFAULT 1"); err != nil {
+		return err
+	}
+	added, err = c.addColumnIfNotExists("videos", "visibility", "TEXT NOT NULL DEFAULT 'private'")
+	if err != nil {
+		return err
+	}
+	if added {
+		// Before visibility existed anyone with a video's ID could fetch it
+		_, err = c.db.Exec("UPDATE videos SET visibility = 'unlisted'")
+		if err != nil {
+			return err
+		}
+	}
+	if _, err := c.addColumnIfNotExists("videos", "publish_at", "TIMESTAMP"); err != nil {
+		return err
+	}
+	if _, err := c.addColumnIfNotExists("videos", "publish_visibility", "TEXT"); err != nil {
+		return err
+	}
+	if _, err := c.addColumnIfNotExists("videos", "deleted_at", "TIMESTAMP"); err != nil {
+		return err
+	}
+	if _, err := c.addColumnIfNotExists("videos", "active_version_id", "TEXT"); err != nil {
+		return err
+	}
+	if _, err := c.addColumnIfNotExists("videos", "integrated_loudness", "REAL"); err != nil {
+		return err
+	}
+	if _, err := c.addColumnIfNotExists("videos", "true_peak", "REAL"); err != nil {
+		return err
+	}
+	if _, err := c.addColumnIfNotExists("videos", "media_kind", "TEXT NOT NULL DEFAULT 'video'"); err != nil {
+		return err
+	}
+	return nil
+}
+
+// migrateLegacyVersions gives videos uploaded before versions existed a
+// version for the media they already have, so it can be listed, rolled back
+// to and cleaned up like that of any other upload.
+func (c *Client) migrateLegacyVersions() error {
+	rows, err := c.db.Query(`
+	SELECT id, user_id, video_url, media_kind, duration, aspect_class, integrated_loudness, true_peak
+	FROM videos
+	WHERE video_url IS NOT NULL AND active_version_id IS NULL
+	`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	type legacyVideo struct {
+		videoURL string
+		params   CreateVideoVersionParams
+	}
+	legacyVideos := []legacyVideo{}
+	for rows.Next() {
+		var video legacyVideo
+		err := rows.Scan(
+			&video.params.VideoID,
+			&video.params.UploadedBy,
+			&video.videoURL,
+			&video.params.MediaKind,
+			&video.params.Duration,
+			&video.params.AspectClass,
+			&video.params.IntegratedLoudness,
+			&video.params.TruePeak,
+		)
+		if err != nil {
+			return err
+		}
+		legacyVideos = append(legacyVideos, video)
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows.Close()
+
+	for _, video := range legacyVideos {
+		// Media was always served from a URL whose path is its storage key
+		parsed, err := url.Parse(video.videoURL)
+		if err != nil || strings.TrimPrefix(parsed.Path, "/") == "" {
+			continue
+		}
+		err = c.createLegacyVersion(video.params, strings.TrimPrefix(parsed.Path, "/"))
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+func (c *Client) createLegacyVersion(params CreateVideoVersionParams, storageKey string) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// The size was never recorded
+	id := uuid.New()
+	_, err = tx.Exec(`
+	INSERT INTO video_versions (
+		id, video_id, version, storage_key, media_kind, duration, aspect_class,
+		integrated_loudness, true_peak, size_bytes, uploaded_by, created_at
+	) VALUES (
+		?, ?, (SELECT COALESCE(MAX(version), 0) + 1 FROM video_versions WHERE video_id = ?),
+		?, ?, ?, ?, ?, ?, 0, ?, CURRENT_TIMESTAMP
+	)
+	`, id, params.VideoID, params.VideoID, storageKey, params.MediaKind, params.Duration, params.AspectClass,
+		params.IntegratedLoudness, params.TruePeak, params.UploadedBy)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE videos SET active_version_id = ? WHERE id = ?", id, params.VideoID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// migrateVersionTracks moves audio tracks and embedded caption tracks, which
+// used to belong to the video, onto its active version, where they now live
+// so that they follow it when another version is activated.
+func (c *Client) migrateVersionTracks() error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var legacyAudioTracks int
+	err = tx.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'audio_tracks'").Scan(&legacyAudioTracks)
+	if err != nil {
+		return err
+	}
+	if legacyAudioTracks > 0 {
+		_, err = tx.Exec(`
+		INSERT OR IGNORE INTO version_audio_tracks (version_id, position, language, label, codec, channels, is_default)
+		SELECT videos.active_version_id, position, language, label, codec, channels, is_default
+		FROM audio_tracks
+		JOIN videos ON videos.id = audio_tracks.video_id
+		WHERE videos.active_version_id IS NOT NULL
+		`)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec("DROP TABLE audio_tracks")
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec(`
+	INSERT OR IGNORE INTO version_caption_tracks (version_id, language, label, url, created_at)
+	SELECT videos.active_version_id, language, label, url, caption_tracks.created_at
+	FROM caption_tracks
+	JOIN videos ON videos.id = caption_tracks.video_id
+	WHERE caption_tracks.source = ? AND videos.active_version_id IS NOT NULL
+	`, CaptionSourceEmbedded)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM caption_tracks WHERE source = ?", CaptionSourceEmbedded)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// addColumnIfNotExists reports whether the column had to be added.
+func (c *Client) addColumnIfNotExists(table, column, definition string) (bool, error) {
+	rows, err := c.db.Query(fmt.Sprintf("PRAGMA table_info(%s)", table))
+	if err != nil {
+		return false, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			cid        int
+			name       string
+			columnType string
+			notNull    bool
+			defaultVal sql.NullString
+			primaryKey int
+		)
+		if err := rows.Scan(&cid, &name, &columnType, &notNull, &defaultVal, &primaryKey); err != nil {
+			return false, err
+		}
+		if name == column {
+			return false, nil
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+	rows.Close()
+
+	_, err = c.db.Exec(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s %s", table, column, definition))
+	if err != nil {
+		return false, fmt.Errorf("failed to add column %s.%s: %w", table, column, err)
+	}
+	return true, nil
+}
+
 func (c Client) Reset() error {
 	if _, err := c.db.Exec("DELETE FROM refresh_tokens"); err != nil {
 		return fmt.Errorf("failed to reset table refresh_tokens: %w", err)
 	}
+	if _, err := c.db.Exec("DELETE FROM watermarks"); err != nil {
+		return fmt.Errorf("failed to reset table watermarks: %w", err)
+	}
 	if _, err := c.db.Exec("DELETE FROM users"); err != nil {
 		return fmt.Errorf("failed to reset table users: %w", err)
 	}
+	if _, err := c.db.Exec("DELETE FROM share_links"); err != nil {
+		return fmt.Errorf("failed to reset table share_links: %w", err)
+	}
+	for _, table := range []string{"version_assets", "chapters", "processing_jobs", "version_audio_tracks", "version_caption_tracks", "caption_tracks", "video_versions", "video_reactions", "comments", "watch_progress", "playback_sessions", "video_daily_viewers", "video_daily_stats"} {
+		if _, err := c.db.Exec("DELETE FROM " + table); err != nil {
+			return fmt.Errorf("failed to reset table %s: %w", table, err)
+		}
+	}
+	if _, err := c.db.Exec("DELETE FROM playlist_items"); err != nil {
+		return fmt.Errorf("failed to reset table playlist_items: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM playlists"); err != nil {
+		return fmt.Errorf("failed to reset table playlists: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM video_tags"); err != nil {
+		return fmt.Errorf("failed to reset table video_tags: %w", err)
+	}
+	if _, err := c.db.Exec("DELETE FROM tags"); err != nil {
+		return fmt.Errorf("failed to reset table tags: %w", err)
+	}
 	if _, err := c.db.Exec("DELETE FROM videos"); err != nil {
 		return fmt.Errorf("failed to reset table videos: %w", err)
 	}
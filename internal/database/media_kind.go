@@ -0,0 +1,9 @@
+package database
+
+// MediaKind says whether a video's media has pictures or is audio only.
+type MediaKind string
+
+const (
+	MediaKindVideo MediaKind = "video"
+	MediaKindAudio MediaKind = "audio"
+)
@@ -0,0 +1,368 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Playlist struct {
+	ID        uuid.UUID      `json:"id"`
+	CreatedAt time.Time      `json:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at"`
+	Items     []PlaylistItem `json:"items,omitempty"`
+	CreatePlaylistParams
+}
+
+type CreatePlaylistParams struct {
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Visibility  Visibility `json:"visibility"`
+	UserID      uuid.UUID  `json:"user_id"`
+}
+
+// PlaylistItem positions are kept dense, running from 0 to len(items)-1.
+type PlaylistItem struct {
+	ID       uuid.UUID `json:"id"`
+	Position int       `json:"position"`
+	AddedAt  time.Time `json:"added_at"`
+	Video    Video     `json:"video"`
+}
+
+var ErrDuplicatePlaylistItem = errors.New("video is already in the playlist")
+
+func (p Playlist) CanBeViewedBy(userID uuid.UUID) bool {
+	return p.UserID == userID || p.Visibility != VisibilityPrivate
+}
+
+func (c Client) CreatePlaylist(params CreatePlaylistParams) (Playlist, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO playlists (
+		id,
+		created_at,
+		updated_at,
+		title,
+		description,
+		visibility,
+		user_id
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?)
+	`
+	if params.Visibility == "" {
+		params.Visibility = VisibilityPrivate
+	}
+	_, err := c.db.Exec(query, id, params.Title, params.Description, params.Visibility, params.UserID)
+	if err != nil {
+		return Playlist{}, err
+	}
+
+	return c.GetPlaylist(id)
+}
+
+func (c Client) GetPlaylist(id uuid.UUID) (Playlist, error) {
+	query := `
+	SELECT id, created_at, updated_at, title, description, visibility, user_id
+	FROM playlists
+	WHERE id = ?
+	`
+	var playlist Playlist
+	err := c.db.QueryRow(query, id).Scan(
+		&playlist.ID,
+		&playlist.CreatedAt,
+		&playlist.UpdatedAt,
+		&playlist.Title,
+		&playlist.Description,
+		&playlist.Visibility,
+		&playlist.UserID,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Playlist{}, nil
+		}
+		return Playlist{}, err
+	}
+
+	return playlist, nil
+}
+
+func (c Client) GetPlaylists(userID uuid.UUID) ([]Playlist, error) {
+	query := `
+	SELECT id, created_at, updated_at, title, description, visibility, user_id
+	FROM playlists
+	WHERE user_id = ?
+	ORDER BY updated_at DESC
+	`
+	rows, err := c.db.Query(query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	playlists := []Playlist{}
+	for rows.Next() {
+		var playlist Playlist
+		if err := rows.Scan(
+			&playlist.ID,
+			&playlist.CreatedAt,
+			&playlist.UpdatedAt,
+			&playlist.Title,
+			&playlist.Description,
+			&playlist.Visibility,
+			&playlist.UserID,
+		); err != nil {
+			return nil, err
+		}
+		playlists = append(playlists, playlist)
+	}
+
+	return playlists, nil
+}
+
+func (c Client) UpdatePlaylist(playlist Playlist) error {
+	query := `
+	UPDATE playlists
+	SET
+		updated_at = ` + sqliteNowMillis + `,
+		title = ?,
+		description = ?,
+		visibility = ?
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, playlist.Title, playlist.Description, playlist.Visibility, playlist.ID)
+	return err
+}
+
+func (c Client) DeletePlaylist(id uuid.UUID) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM playlist_items WHERE playlist_id = ?", id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM playlists WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (c Client) GetPlaylistItems(playlistID uuid.UUID) ([]PlaylistItem, error) {
+	query := `
+	WITH items AS (
+		SELECT id AS item_id, position, added_at, video_id
+		FROM playlist_items
+		WHERE playlist_id = ?
+	)
+	SELECT` + videoColumns + `,
+		items.item_id,
+		items.position,
+		items.added_at
+	FROM videos
+	JOIN items ON items.video_id = videos.id
+	WHERE deleted_at IS NULL
+	ORDER BY items.position
+	`
+	rows, err := c.db.Query(query, playlistID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []PlaylistItem{}
+	for rows.Next() {
+		var item PlaylistItem
+		item.Video, err = scanVideo(rows, &item.ID, &item.Position, &item.AddedAt)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// AddPlaylistItem inserts a video at position, shifting later items down. A
+// nil or out of range position appends to the end.
+func (c Client) AddPlaylistItem(playlistID, videoID uuid.UUID, position *int) (uuid.UUID, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer tx.Rollback()
+
+	var existing int
+	err = tx.QueryRow("SELECT COUNT(*) FROM playlist_items WHERE playlist_id = ? AND video_id = ?", playlistID, videoID).Scan(&existing)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if existing > 0 {
+		return uuid.Nil, ErrDuplicatePlaylistItem
+	}
+
+	var count int
+	err = tx.QueryRow("SELECT COUNT(*) FROM playlist_items WHERE playlist_id = ?", playlistID).Scan(&count)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	insertAt := count
+	if position != nil && *position >= 0 && *position < count {
+		insertAt = *position
+	}
+
+	_, err = tx.Exec(`
+	UPDATE playlist_items
+	SET position = position + 1
+	WHERE playlist_id = ? AND position >= ?
+	`, playlistID, insertAt)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	id := uuid.New()
+	_, err = tx.Exec(`
+	INSERT INTO playlist_items (id, playlist_id, video_id, position, added_at)
+	VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP)
+	`, id, playlistID, videoID, insertAt)
+	if err != nil {
+		return uuid.Nil, err
+	}
+
+	err = touchPlaylist(tx, playlistID)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return id, tx.Commit()
+}
+
+// MovePlaylistItem moves an item to position (clamped to the playlist),
+// shifting the items in between to keep positions dense. It reports false if
+// the item isn't in the playlist.
+func (c Client) MovePlaylistItem(playlistID, itemID uuid.UUID, position int) (bool, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var current int
+	err = tx.QueryRow("SELECT position FROM playlist_items WHERE id = ? AND playlist_id = ?", itemID, playlistID).Scan(&current)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	var count int
+	err = tx.QueryRow("SELECT COUNT(*) FROM playlist_items WHERE playlist_id = ?", playlistID).Scan(&count)
+	if err != nil {
+		return false, err
+	}
+	position = max(0, min(position, count-1))
+
+	if position < current {
+		_, err = tx.Exec(`
+		UPDATE playlist_items
+		SET position = position + 1
+		WHERE playlist_id = ? AND position >= ? AND position < ?
+		`, playlistID, position, current)
+	} else if position > current {
+		_, err = tx.Exec(`
+		UPDATE playlist_items
+		SET position = position - 1
+		WHERE playlist_id = ? AND position > ? AND position <= ?
+		`, playlistID, current, position)
+	}
+	if err != nil {
+		return false, err
+	}
+
+	_, err = tx.Exec("UPDATE playlist_items SET position = ? WHERE id = ?", position, itemID)
+	if err != nil {
+		return false, err
+	}
+
+	err = touchPlaylist(tx, playlistID)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// RemovePlaylistItem reports false if the item isn't in the playlist.
+func (c Client) RemovePlaylistItem(playlistID, itemID uuid.UUID) (bool, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var position int
+	err = tx.QueryRow("SELECT position FROM playlist_items WHERE id = ? AND playlist_id = ?", itemID, playlistID).Scan(&position)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	_, err = tx.Exec("DELETE FROM playlist_items WHERE id = ?", itemID)
+	if err != nil {
+		return false, err
+	}
+	_, err = tx.Exec(`
+	UPDATE playlist_items
+	SET position = position - 1
+	WHERE playlist_id = ? AND position > ?
+	`, playlistID, position)
+	if err != nil {
+		return false, err
+	}
+
+	err = touchPlaylist(tx, playlistID)
+	if err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// removeVideoFromPlaylists drops a video from every playlist containing it,
+// closing the gap it leaves so positions stay dense.
+func removeVideoFromPlaylists(db execer, videoID uuid.UUID) error {
+	_, err := db.Exec(`
+	UPDATE playlists
+	SET updated_at = `+sqliteNowMillis+`
+	WHERE id IN (SELECT playlist_id FROM playlist_items WHERE video_id = ?)
+	`, videoID)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`
+	UPDATE playlist_items
+	SET position = position - 1
+	WHERE position > (
+		SELECT removed.position
+		FROM playlist_items AS removed
+		WHERE removed.playlist_id = playlist_items.playlist_id AND removed.video_id = ?
+	)
+	`, videoID)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec("DELETE FROM playlist_items WHERE video_id = ?", videoID)
+	return err
+}
+
+func touchPlaylist(db execer, playlistID uuid.UUID) error {
+	_, err := db.Exec("UPDATE playlists SET updated_at = "+sqliteNowMillis+" WHERE id = ?", playlistID)
+	return err
+}
@@ -0,0 +1,154 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ProcessingJobStatus string
+
+const (
+	ProcessingJobRunning   ProcessingJobStatus = "running"
+	ProcessingJobSucceeded ProcessingJobStatus = "succeeded"
+	ProcessingJobFailed    ProcessingJobStatus = "failed"
+)
+
+// ProcessingJob is one run of the processing pipeline over an upload, with
+// the latest progress it reported.
+type ProcessingJob struct {
+	ID      uuid.UUID           `json:"id"`
+	VideoID uuid.UUID           `json:"video_id"`
+	Status  ProcessingJobStatus `json:"status"`
+	// The step the job is on, e.g. "transcoding"
+	Stage string `json:"stage"`
+	// How much of the current stage is done, from 0 to 100, if known
+	Percent *float64 `json:"percent"`
+	// Estimated seconds until the current stage is done, if known
+	ETASeconds *float64   `json:"eta_seconds"`
+	StartedAt  time.Time  `json:"started_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	FinishedAt *time.Time `json:"finished_at"`
+}
+
+func (c Client) CreateProcessingJob(videoID uuid.UUID, stage string) (ProcessingJob, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO processing_jobs (id, video_id, status, stage, started_at, updated_at)
+	VALUES (?, ?, ?, ?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP)
+	`
+	_, err := c.db.Exec(query, id, videoID, ProcessingJobRunning, stage)
+	if err != nil {
+		return ProcessingJob{}, err
+	}
+	return c.GetProcessingJob(id)
+}
+
+// UpdateProcessingJobProgress records how far a running job has got.
+func (c Client) UpdateProcessingJobProgress(id uuid.UUID, stage string, percent, etaSeconds *float64) error {
+	query := `
+	UPDATE processing_jobs
+	SET stage = ?, percent = ?, eta_seconds = ?, updated_at = CURRENT_TIMESTAMP
+	WHERE id = ? AND status = ?
+	`
+	_, err := c.db.Exec(query, stage, percent, etaSeconds, id, ProcessingJobRunning)
+	return err
+}
+
+func (c Client) FinishProcessingJob(id uuid.UUID, status ProcessingJobStatus) error {
+	query := `
+	UPDATE processing_jobs
+	SET status = ?, eta_seconds = NULL, updated_at = CURRENT_TIMESTAMP, finished_at = CURRENT_TIMESTAMP
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, status, id)
+	return err
+}
+
+// FailInterruptedProcessingJobs marks jobs that were still running when the
+// server stopped as failed, as nothing will finish them. Their videos are
+// ready again if an earlier version is still active, and failed otherwise.
+func (c Client) FailInterruptedProcessingJobs() error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+	UPDATE videos
+	SET
+		status = CASE WHEN active_version_id IS NOT NULL THEN ? ELSE ? END,
+		updated_at = `+sqliteNowMillis+`
+	WHERE status = ? AND id IN (SELECT video_id FROM processing_jobs WHERE status = ?)
+	`, VideoStatusReady, VideoStatusFailed, VideoStatusProcessing, ProcessingJobRunning)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+	UPDATE processing_jobs
+	SET status = ?, eta_seconds = NULL, updated_at = CURRENT_TIMESTAMP, finished_at = CURRENT_TIMESTAMP
+	WHERE status = ?
+	`, ProcessingJobFailed, ProcessingJobRunning)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+const processingJobColumns = `
+		id,
+		video_id,
+		status,
+		stage,
+		percent,
+		eta_seconds,
+		started_at,
+		updated_at,
+		finished_at`
+
+func (c Client) GetProcessingJob(id uuid.UUID) (ProcessingJob, error) {
+	query := `
+	SELECT` + processingJobColumns + `
+	FROM processing_jobs
+	WHERE id = ?
+	`
+	return scanProcessingJob(c.db.QueryRow(query, id))
+}
+
+// GetLatestProcessingJob returns the video's most recently started job.
+func (c Client) GetLatestProcessingJob(videoID uuid.UUID) (ProcessingJob, error) {
+	query := `
+	SELECT` + processingJobColumns + `
+	FROM processing_jobs
+	WHERE video_id = ?
+	ORDER BY started_at DESC, rowid DESC
+	LIMIT 1
+	`
+	return scanProcessingJob(c.db.QueryRow(query, videoID))
+}
+
+func scanProcessingJob(row rowScanner) (ProcessingJob, error) {
+	var job ProcessingJob
+	err := row.Scan(
+		&job.ID,
+		&job.VideoID,
+		&job.Status,
+		&job.Stage,
+		&job.Percent,
+		&job.ETASeconds,
+		&job.StartedAt,
+		&job.UpdatedAt,
+		&job.FinishedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ProcessingJob{}, nil
+		}
+		return ProcessingJob{}, err
+	}
+	return job, nil
+}
@@ -0,0 +1,78 @@
+package database
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestFailInterruptedProcessingJobs(t *testing.T) {
+	db, err := NewClient(filepath.Join(t.TempDir(), "tubely.db"))
+	if err != nil {
+		t.Fatalf("NewClient() error: %v", err)
+	}
+	user, err := db.CreateUser(CreateUserParams{Email: "owner@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatalf("CreateUser() error: %v", err)
+	}
+
+	// A re-upload of a video that already plays, and a first upload
+	reuploaded := createVideo(t, db, user.ID)
+	version, err := db.CreateVideoVersion(CreateVideoVersionParams{
+		VideoID:    reuploaded,
+		StorageKey: "landscape/v1.mp4",
+		MediaKind:  MediaKindVideo,
+		UploadedBy: user.ID,
+	})
+	if err != nil {
+		t.Fatalf("CreateVideoVersion() error: %v", err)
+	}
+	if err := db.ActivateVideoVersion(version, "https://cdn.example.com/landscape/v1.mp4"); err != nil {
+		t.Fatalf("ActivateVideoVersion() error: %v", err)
+	}
+	firstUpload := createVideo(t, db, user.ID)
+
+	jobs := map[uuid.UUID]uuid.UUID{}
+	for _, videoID := range []uuid.UUID{reuploaded, firstUpload} {
+		if err := db.SetVideoStatus(videoID, VideoStatusProcessing); err != nil {
+			t.Fatalf("SetVideoStatus() error: %v", err)
+		}
+		job, err := db.CreateProcessingJob(videoID, "transcoding")
+		if err != nil {
+			t.Fatalf("CreateProcessingJob() error: %v", err)
+		}
+		jobs[videoID] = job.ID
+	}
+
+	if err := db.FailInterruptedProcessingJobs(); err != nil {
+		t.Fatalf("FailInterruptedProcessingJobs() error: %v", err)
+	}
+
+	expected := map[uuid.UUID]VideoStatus{reuploaded: VideoStatusReady, firstUpload: VideoStatusFailed}
+	for videoID, status := range expected {
+		video, err := db.GetVideo(videoID)
+		if err != nil {
+			t.Fatalf("GetVideo() error: %v", err)
+		}
+		if video.Status != status {
+			t.Errorf("video status = %s; want %s", video.Status, status)
+		}
+		job, err := db.GetProcessingJob(jobs[videoID])
+		if err != nil {
+			t.Fatalf("GetProcessingJob() error: %v", err)
+		}
+		if job.Status != ProcessingJobFailed || job.FinishedAt == nil {
+			t.Errorf("job status = %s, finished at %v; want failed and finished", job.Status, job.FinishedAt)
+		}
+	}
+}
+
+func createVideo(t *testing.T, db Client, userID uuid.UUID) uuid.UUID {
+	t.Helper()
+	video, err := db.CreateVideo(CreateVideoParams{Title: "Upload", Visibility: VisibilityPrivate, UserID: userID})
+	if err != nil {
+		t.Fatalf("CreateVideo() error: %v", err)
+	}
+	return video.ID
+}
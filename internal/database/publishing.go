@@ -0,0 +1,51 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PublishDueVideos moves every video whose publish_at is at or before now to
+// its scheduled visibility, clearing the schedule, and returns their IDs.
+func (c Client) PublishDueVideos(now time.Time) ([]uuid.UUID, error) {
+	query := `
+	UPDATE videos
+	SET
+		visibility = COALESCE(publish_visibility, ?),
+		publish_at = NULL,
+		publish_visibility = NULL,
+		updated_at = ` + sqliteNowMillis + `
+	WHERE publish_at IS NOT NULL AND publish_at <= ? AND deleted_at IS NULL
+	RETURNING id
+	`
+	rows, err := c.db.Query(query, VisibilityPublic, now.UTC().Format(sqliteTimestampFormat))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ids := []uuid.UUID{}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// formatOptionalTimestamp stores times in the same UTC layout as
+// CURRENT_TIMESTAMP so they compare correctly as text.
+func formatOptionalTimestamp(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	s := t.UTC().Format(sqliteTimestampFormat)
+	return &s
+}
@@ -0,0 +1,135 @@
+package database
+
+import (
+	"encoding/json"
+
+	"github.com/google/uuid"
+)
+
+type Reaction string
+
+// The fixed set of reactions users can leave on a video. A like is just
+// another reaction.
+const (
+	ReactionLike      Reaction = "like"
+	ReactionLove      Reaction = "love"
+	ReactionLaugh     Reaction = "laugh"
+	ReactionWow       Reaction = "wow"
+	ReactionSad       Reaction = "sad"
+	ReactionCelebrate Reaction = "celebrate"
+)
+
+func (r Reaction) Valid() bool {
+	switch r {
+	case ReactionLike, ReactionLove, ReactionLaugh, ReactionWow, ReactionSad, ReactionCelebrate:
+		return true
+	default:
+		return false
+	}
+}
+
+// Aggregate counts for videoColumns, as a JSON object of reaction to count
+const videoReactionsColumn = `
+		(
+			SELECT json_group_object(reaction, count)
+			FROM (
+				SELECT reaction, COUNT(*) AS count
+				FROM video_reactions
+				WHERE video_reactions.video_id = videos.id
+				GROUP BY reaction
+			)
+		)`
+
+func parseReactionCounts(counts *string) (map[Reaction]int, error) {
+	reactions := map[Reaction]int{}
+	if counts == nil {
+		return reactions, nil
+	}
+	err := json.Unmarshal([]byte(*counts), &reactions)
+	return reactions, err
+}
+
+// AddReaction is idempotent: reacting twice with the same reaction is a no-op.
+func (c Client) AddReaction(userID, videoID uuid.UUID, reaction Reaction) error {
+	query := `
+	INSERT OR IGNORE INTO video_reactions (video_id, user_id, reaction, created_at)
+	VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+	`
+	_, err := c.db.Exec(query, videoID, userID, reaction)
+	return err
+}
+
+// RemoveReaction is idempotent: removing a reaction that isn't there is a no-op.
+func (c Client) RemoveReaction(userID, videoID uuid.UUID, reaction Reaction) error {
+	query := `
+	DELETE FROM video_reactions
+	WHERE video_id = ? AND user_id = ? AND reaction = ?
+	`
+	_, err := c.db.Exec(query, videoID, userID, reaction)
+	return err
+}
+
+func (c Client) GetUserReactions(userID, videoID uuid.UUID) ([]Reaction, error) {
+	query := `
+	SELECT reaction
+	FROM video_reactions
+	WHERE video_id = ? AND user_id = ?
+	ORDER BY reaction
+	`
+	rows, err := c.db.Query(query, videoID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reactions := []Reaction{}
+	for rows.Next() {
+		var reaction Reaction
+		if err := rows.Scan(&reaction); err != nil {
+			return nil, err
+		}
+		reactions = append(reactions, reaction)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reactions, nil
+}
+
+// GetLikedVideos lists videos the user has liked, most recently liked first,
+// skipping any they can no longer view.
+func (c Client) GetLikedVideos(userID uuid.UUID, limit, offset int) ([]Video, error) {
+	query := `
+	WITH liked AS (
+		SELECT video_id, created_at AS liked_at
+		FROM video_reactions
+		WHERE user_id = ? AND reaction = ?
+	)
+	SELECT` + videoColumns + `
+	FROM videos
+	JOIN liked ON liked.video_id = videos.id
+	WHERE deleted_at IS NULL AND (user_id = ? OR visibility != ?)
+	ORDER BY liked.liked_at DESC, videos.id
+	LIMIT ? OFFSET ?
+	`
+	rows, err := c.db.Query(query, userID, ReactionLike, userID, VisibilityPrivate, limit, offset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	videos := []Video{}
+	for rows.Next() {
+		video, err := scanVideo(rows)
+		if err != nil {
+			return nil, err
+		}
+		videos = append(videos, video)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return videos, nil
+}
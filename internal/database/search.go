@@ -0,0 +1,200 @@
+package database
+
+import (
+	"errors"
+	"html"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+var ErrSearchUnavailable = errors.New("search requires building with -tags sqlite_fts5")
+
+// Markers wrapped around matched terms in search snippets. SQLite's snippet
+// doesn't escape the text around them, so it marks matches with control
+// characters, which highlightSnippet turns into tags once the text is escaped.
+const (
+	searchHighlightStart = "<mark>"
+	searchHighlightEnd   = "</mark>"
+	snippetMatchStart    = "\x02"
+	snippetMatchEnd      = "\x03"
+)
+
+type SearchVideosParams struct {
+	Query string
+	// uuid.Nil for anonymous searches, which only see public videos
+	UserID uuid.UUID
+	Limit  int
+	Offset int
+}
+
+type VideoSearchResult struct {
+	Video
+	TitleSnippet       string `json:"title_snippet"`
+	DescriptionSnippet string `json:"description_snippet"`
+}
+
+// migrateSearchIndex keeps a videos_fts table in step with videos via
+// triggers. It's a standalone (not external content) table keyed by video ID,
+// since videos has no stable integer rowid to hang external content off.
+func (c *Client) migrateSearchIndex() error {
+	if !searchAvailable {
+		// A build with FTS5 may have left its triggers behind, and without
+		// the module every write to videos would fail. They're put back, and
+		// the index rebuilt, the next time a build with FTS5 starts
+		_, err := c.db.Exec(`
+		DROP TRIGGER IF EXISTS videos_fts_insert;
+		DROP TRIGGER IF EXISTS videos_fts_update;
+		DROP TRIGGER IF EXISTS videos_fts_delete;
+		`)
+		return err
+	}
+
+	var existing, triggers int
+	err := c.db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = 'videos_fts'").Scan(&existing)
+	if err != nil {
+		return err
+	}
+	err = c.db.QueryRow(`
+	SELECT COUNT(*) FROM sqlite_master
+	WHERE type = 'trigger' AND name IN ('videos_fts_insert', 'videos_fts_update', 'videos_fts_delete')
+	`).Scan(&triggers)
+	if err != nil {
+		return err
+	}
+
+	searchTable := `
+	CREATE VIRTUAL TABLE IF NOT EXISTS videos_fts USING fts5(
+		video_id UNINDEXED,
+		title,
+		description,
+		tokenize = 'porter unicode61'
+	);
+
+	CREATE TRIGGER IF NOT EXISTS videos_fts_insert AFTER INSERT ON videos BEGIN
+		INSERT INTO videos_fts (video_id, title, description)
+		VALUES (new.id, new.title, COALESCE(new.description, ''));
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS videos_fts_update AFTER UPDATE OF title, description ON videos BEGIN
+		DELETE FROM videos_fts WHERE video_id = old.id;
+		INSERT INTO videos_fts (video_id, title, description)
+		VALUES (new.id, new.title, COALESCE(new.description, ''));
+	END;
+
+	CREATE TRIGGER IF NOT EXISTS videos_fts_delete AFTER DELETE ON videos BEGIN
+		DELETE FROM videos_fts WHERE video_id = old.id;
+	END;
+	`
+	_, err = c.db.Exec(searchTable)
+	if err != nil {
+		return err
+	}
+
+	// Index whatever was already there when the table was first created, or
+	// start again if the table missed changes while its triggers were gone
+	if existing == 0 || triggers < 3 {
+		_, err = c.db.Exec(`
+		DELETE FROM videos_fts;
+		INSERT INTO videos_fts (video_id, title, description)
+		SELECT id, title, COALESCE(description, '') FROM videos;
+		`)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c Client) SearchVideos(params SearchVideosParams) ([]VideoSearchResult, error) {
+	if !searchAvailable {
+		return nil, ErrSearchUnavailable
+	}
+
+	matchQuery := ftsQuery(params.Query)
+	results := []VideoSearchResult{}
+	if matchQuery == "" {
+		return results, nil
+	}
+
+	// Title matches are weighted well above description matches
+	query := `
+	WITH matches AS (
+		SELECT
+			video_id,
+			snippet(videos_fts, 1, ?, ?, '…', 12) AS title_snippet,
+			snippet(videos_fts, 2, ?, ?, '…', 24) AS description_snippet,
+			bm25(videos_fts, 0.0, 10.0, 1.0) AS rank
+		FROM videos_fts
+		WHERE videos_fts MATCH ?
+	)
+	SELECT` + videoColumns + `,
+		matches.title_snippet,
+		matches.description_snippet
+	FROM videos
+	JOIN matches ON matches.video_id = videos.id
+	WHERE deleted_at IS NULL AND (user_id = ? OR visibility = ?)
+	ORDER BY matches.rank, created_at DESC
+	LIMIT ? OFFSET ?
+	`
+
+	rows, err := c.db.Query(
+		query,
+		snippetMatchStart, snippetMatchEnd,
+		snippetMatchStart, snippetMatchEnd,
+		matchQuery,
+		params.UserID,
+		VisibilityPublic,
+		params.Limit,
+		params.Offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var titleSnippet, descriptionSnippet *string
+		video, err := scanVideo(rows, &titleSnippet, &descriptionSnippet)
+		if err != nil {
+			return nil, err
+		}
+		result := VideoSearchResult{Video: video}
+		if titleSnippet != nil {
+			result.TitleSnippet = highlightSnippet(*titleSnippet)
+		}
+		if descriptionSnippet != nil {
+			result.DescriptionSnippet = highlightSnippet(*descriptionSnippet)
+		}
+		results = append(results, result)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// highlightSnippet makes a snippet safe to render as HTML, with matches
+// wrapped in <mark> tags.
+func highlightSnippet(snippet string) string {
+	escaped := html.EscapeString(snippet)
+	escaped = strings.ReplaceAll(escaped, snippetMatchStart, searchHighlightStart)
+	return strings.ReplaceAll(escaped, snippetMatchEnd, searchHighlightEnd)
+}
+
+// ftsQuery turns free text into an FTS5 query that can't fail to parse: every
+// word is quoted so operators and punctuation are matched literally, and the
+// last word is treated as a prefix to support search-as-you-type.
+func ftsQuery(q string) string {
+	words := strings.Fields(q)
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		terms = append(terms, `"`+strings.ReplaceAll(word, `"`, `""`)+`"`)
+	}
+	if len(terms) == 0 {
+		return ""
+	}
+	terms[len(terms)-1] += "*"
+	return strings.Join(terms, " ")
+}
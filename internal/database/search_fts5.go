@@ -0,0 +1,6 @@
+//go:build sqlite_fts5
+
+package database
+
+// go-sqlite3 only compiles in FTS5 when built with the sqlite_fts5 tag
+const searchAvailable = true
@@ -0,0 +1,82 @@
+//go:build sqlite_fts5
+
+package database
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestSearchVideosEscapesSnippets(t *testing.T) {
+	db, err := NewClient(filepath.Join(t.TempDir(), "tubely.db"))
+	if err != nil {
+		t.Fatalf("NewClient() error: %v", err)
+	}
+	user, err := db.CreateUser(CreateUserParams{Email: "owner@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatalf("CreateUser() error: %v", err)
+	}
+	_, err = db.CreateVideo(CreateVideoParams{
+		Title:       `<script>alert("pwned")</script> launch`,
+		Description: "<b>bold</b> launch notes",
+		Visibility:  VisibilityPublic,
+		UserID:      user.ID,
+	})
+	if err != nil {
+		t.Fatalf("CreateVideo() error: %v", err)
+	}
+
+	results, err := db.SearchVideos(SearchVideosParams{Query: "launch", Limit: 10})
+	if err != nil {
+		t.Fatalf("SearchVideos() error: %v", err)
+	}
+	if len(results) != 1 {
+		t.Fatalf("got %d results; want 1", len(results))
+	}
+	title := "&lt;script&gt;alert(&#34;pwned&#34;)&lt;/script&gt; <mark>launch</mark>"
+	if results[0].TitleSnippet != title {
+		t.Errorf("TitleSnippet = %q; want %q", results[0].TitleSnippet, title)
+	}
+	description := "&lt;b&gt;bold&lt;/b&gt; <mark>launch</mark> notes"
+	if results[0].DescriptionSnippet != description {
+		t.Errorf("DescriptionSnippet = %q; want %q", results[0].DescriptionSnippet, description)
+	}
+}
+
+func TestMigrateSearchIndexRebuildsAfterTriggersWereDropped(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tubely.db")
+	db, err := NewClient(path)
+	if err != nil {
+		t.Fatalf("NewClient() error: %v", err)
+	}
+	user, err := db.CreateUser(CreateUserParams{Email: "owner@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatalf("CreateUser() error: %v", err)
+	}
+	// As a build without FTS5 leaves things, then adds a video
+	_, err = db.db.Exec(`
+	DROP TRIGGER videos_fts_insert;
+	DROP TRIGGER videos_fts_update;
+	DROP TRIGGER videos_fts_delete;
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = db.CreateVideo(CreateVideoParams{Title: "Launch day", Visibility: VisibilityPublic, UserID: user.ID})
+	if err != nil {
+		t.Fatalf("CreateVideo() error: %v", err)
+	}
+	db.db.Close()
+
+	db, err = NewClient(path)
+	if err != nil {
+		t.Fatalf("NewClient() on reopening error: %v", err)
+	}
+	results, err := db.SearchVideos(SearchVideosParams{Query: "launch", Limit: 10})
+	if err != nil {
+		t.Fatalf("SearchVideos() error: %v", err)
+	}
+	if len(results) != 1 {
+		t.Errorf("got %d results; want the video added while search was unavailable", len(results))
+	}
+}
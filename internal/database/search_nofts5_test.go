@@ -0,0 +1,40 @@
+//go:build !sqlite_fts5
+
+package database
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrateSearchIndexDropsTriggersWithoutFTS5(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tubely.db")
+	db, err := NewClient(path)
+	if err != nil {
+		t.Fatalf("NewClient() error: %v", err)
+	}
+	// As left by a build with FTS5; without the module the table can't exist
+	_, err = db.db.Exec(`
+	CREATE TRIGGER videos_fts_insert AFTER INSERT ON videos BEGIN
+		INSERT INTO videos_fts (video_id, title, description)
+		VALUES (new.id, new.title, COALESCE(new.description, ''));
+	END;
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.db.Close()
+
+	db, err = NewClient(path)
+	if err != nil {
+		t.Fatalf("NewClient() on reopening error: %v", err)
+	}
+	user, err := db.CreateUser(CreateUserParams{Email: "owner@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatalf("CreateUser() error: %v", err)
+	}
+	_, err = db.CreateVideo(CreateVideoParams{Title: "Launch", Visibility: VisibilityPublic, UserID: user.ID})
+	if err != nil {
+		t.Errorf("CreateVideo() error: %v; want the stale trigger dropped", err)
+	}
+}
@@ -0,0 +1,24 @@
+package database
+
+import "testing"
+
+func TestHighlightSnippet(t *testing.T) {
+	tests := []struct {
+		snippet  string
+		expected string
+	}{
+		{"Cats \x02playing\x03 piano", "Cats <mark>playing</mark> piano"},
+		{
+			"\x02<script>alert(1)</script>\x03 & more",
+			"<mark>&lt;script&gt;alert(1)&lt;/script&gt;</mark> &amp; more",
+		},
+		{`<img src=x onerror="alert(1)">`, "&lt;img src=x onerror=&#34;alert(1)&#34;&gt;"},
+	}
+
+	for _, tt := range tests {
+		result := highlightSnippet(tt.snippet)
+		if result != tt.expected {
+			t.Errorf("highlightSnippet(%q) = %q; want %q", tt.snippet, result, tt.expected)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type ShareLink struct {
+	Token       string    `json:"token"`
+	CreatedAt   time.Time `json:"created_at"`
+	ViewCount   int       `json:"view_count"`
+	HasPassword bool      `json:"has_password"`
+	Password    *string   `json:"-"`
+	CreateShareLinkParams
+}
+
+type CreateShareLinkParams struct {
+	VideoID   uuid.UUID `json:"video_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+	MaxViews  *int      `json:"max_views"`
+}
+
+func (c Client) CreateShareLink(token string, params CreateShareLinkParams, passwordHash *string) (ShareLink, error) {
+	query := `
+	INSERT INTO share_links (
+		token,
+		created_at,
+		video_id,
+		expires_at,
+		max_views,
+		view_count,
+		password
+	) VALUES (?, CURRENT_TIMESTAMP, ?, ?, ?, 0, ?)
+	`
+	_, err := c.db.Exec(query, token, params.VideoID, params.ExpiresAt.UTC(), params.MaxViews, passwordHash)
+	if err != nil {
+		return ShareLink{}, err
+	}
+
+	return c.GetShareLink(token)
+}
+
+func (c Client) GetShareLink(token string) (ShareLink, error) {
+	query := `
+	SELECT
+		token,
+		created_at,
+		video_id,
+		expires_at,
+		max_views,
+		view_count,
+		password
+	FROM share_links
+	WHERE token = ?
+	`
+
+	var link ShareLink
+	err := c.db.QueryRow(query, token).Scan(
+		&link.Token,
+		&link.CreatedAt,
+		&link.VideoID,
+		&link.ExpiresAt,
+		&link.MaxViews,
+		&link.ViewCount,
+		&link.Password,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ShareLink{}, nil
+		}
+		return ShareLink{}, err
+	}
+	link.HasPassword = link.Password != nil
+
+	return link, nil
+}
+
+func (c Client) GetShareLinks(videoID uuid.UUID) ([]ShareLink, error) {
+	query := `
+	SELECT
+		token,
+		created_at,
+		video_id,
+		expires_at,
+		max_views,
+		view_count,
+		password
+	FROM share_links
+	WHERE video_id = ?
+	ORDER BY created_at DESC
+	`
+
+	rows, err := c.db.Query(query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	links := []ShareLink{}
+	for rows.Next() {
+		var link ShareLink
+		if err := rows.Scan(
+			&link.Token,
+			&link.CreatedAt,
+			&link.VideoID,
+			&link.ExpiresAt,
+			&link.MaxViews,
+			&link.ViewCount,
+			&link.Password,
+		); err != nil {
+			return nil, err
+		}
+		link.HasPassword = link.Password != nil
+		links = append(links, link)
+	}
+
+	return links, nil
+}
+
+// ConsumeShareLinkView records a view against the link, returning false if
+// the link has already reached its view limit.
+func (c Client) ConsumeShareLinkView(token string) (bool, error) {
+	query := `
+	UPDATE share_links
+	SET view_count = view_count + 1
+	WHERE token = ?
+		AND (max_views IS NULL OR view_count < max_views)
+	`
+	result, err := c.db.Exec(query, token)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func (c Client) DeleteShareLink(token string) error {
+	query := `
+	DELETE FROM share_links
+	WHERE token = ?
+	`
+	_, err := c.db.Exec(query, token)
+	return err
+}
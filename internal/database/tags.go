@@ -0,0 +1,138 @@
+package database
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Tag names are normalised by callers and can't contain commas, which lets
+// videoColumns fetch a video's tags with a single group_concat.
+const videoTagsColumn = `
+		(
+			SELECT group_concat(tags.name)
+			FROM video_tags
+			JOIN tags ON tags.id = video_tags.tag_id
+			WHERE video_tags.video_id = videos.id
+		)`
+
+type TagCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+func splitTags(tags *string) []string {
+	if tags == nil || *tags == "" {
+		return []string{}
+	}
+	names := strings.Split(*tags, ",")
+	sort.Strings(names)
+	return names
+}
+
+// AddVideoTags tags a video with names, creating any of the owner's tags that
+// don't exist yet. Tags already on the video are left alone.
+func (c Client) AddVideoTags(userID, videoID uuid.UUID, names []string) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, name := range names {
+		_, err = tx.Exec(`
+		INSERT OR IGNORE INTO tags (id, created_at, user_id, name)
+		VALUES (?, CURRENT_TIMESTAMP, ?, ?)
+		`, uuid.New(), userID, name)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`
+		INSERT OR IGNORE INTO video_tags (video_id, tag_id, created_at)
+		SELECT ?, id, CURRENT_TIMESTAMP
+		FROM tags
+		WHERE user_id = ? AND name = ?
+		`, videoID, userID, name)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = tx.Exec("UPDATE videos SET updated_at = "+sqliteNowMillis+" WHERE id = ?", videoID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RemoveVideoTag removes a tag from a video, deleting the tag entirely once no
+// video uses it.
+func (c Client) RemoveVideoTag(userID, videoID uuid.UUID, name string) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+	DELETE FROM video_tags
+	WHERE video_id = ?
+		AND tag_id IN (SELECT id FROM tags WHERE user_id = ? AND name = ?)
+	`, videoID, userID, name)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE videos SET updated_at = "+sqliteNowMillis+" WHERE id = ?", videoID)
+	if err != nil {
+		return err
+	}
+	err = deleteUnusedTags(tx)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func deleteUnusedTags(db execer) error {
+	_, err := db.Exec(`
+	DELETE FROM tags
+	WHERE id NOT IN (SELECT tag_id FROM video_tags)
+	`)
+	return err
+}
+
+// GetTags lists a user's tags with how many videos use each, most used first.
+// A non-empty prefix restricts the list for autocompletion.
+func (c Client) GetTags(userID uuid.UUID, prefix string, limit int) ([]TagCount, error) {
+	query := `
+	SELECT tags.name, COUNT(video_tags.video_id) AS count
+	FROM tags
+	LEFT JOIN video_tags ON video_tags.tag_id = tags.id
+	WHERE tags.user_id = ?
+		AND tags.name LIKE ? ESCAPE '\'
+	GROUP BY tags.id
+	ORDER BY count DESC, tags.name
+	LIMIT ?
+	`
+	escaped := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(prefix)
+	rows, err := c.db.Query(query, userID, escaped+"%", limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []TagCount{}
+	for rows.Next() {
+		var tag TagCount
+		if err := rows.Scan(&tag.Name, &tag.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tags, nil
+}
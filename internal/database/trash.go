@@ -0,0 +1,74 @@
+package database
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TrashVideo hides the video everywhere until it's restored or purged.
+func (c Client) TrashVideo(id uuid.UUID, deletedAt time.Time) error {
+	query := `
+	UPDATE videos
+	SET deleted_at = ?, updated_at = ` + sqliteNowMillis + `
+	WHERE id = ? AND deleted_at IS NULL
+	`
+	_, err := c.db.Exec(query, deletedAt.UTC().Format(sqliteTimestampFormat), id)
+	return err
+}
+
+func (c Client) RestoreVideo(id uuid.UUID) error {
+	query := `
+	UPDATE videos
+	SET deleted_at = NULL, updated_at = ` + sqliteNowMillis + `
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, id)
+	return err
+}
+
+// GetTrashedVideos lists the user's trashed videos, most recently deleted
+// first.
+func (c Client) GetTrashedVideos(userID uuid.UUID) ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE user_id = ? AND deleted_at IS NOT NULL
+	ORDER BY deleted_at DESC, id
+	`
+	return c.queryVideos(query, userID)
+}
+
+// GetVideosTrashedBefore lists every user's videos that were trashed at or
+// before cutoff, for purging.
+func (c Client) GetVideosTrashedBefore(cutoff time.Time) ([]Video, error) {
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE deleted_at IS NOT NULL AND deleted_at <= ?
+	ORDER BY deleted_at
+	`
+	return c.queryVideos(query, cutoff.UTC().Format(sqliteTimestampFormat))
+}
+
+func (c Client) queryVideos(query string, args ...any) ([]Video, error) {
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	videos := []Video{}
+	for rows.Next() {
+		video, err := scanVideo(rows)
+		if err != nil {
+			return nil, err
+		}
+		videos = append(videos, video)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return videos, nil
+}
@@ -0,0 +1,116 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+
+	"github.com/google/uuid"
+)
+
+// AssetKind names a file derived from a version's media during processing.
+type AssetKind string
+
+const (
+	// Sprite sheet of frames for scrubbing previews
+	AssetSprite AssetKind = "sprite"
+	// WebVTT track mapping time ranges to regions of the sprite sheet
+	AssetThumbnailsVTT AssetKind = "thumbnails_vtt"
+	// Short silent looping preview clips
+	AssetPreviewWebP AssetKind = "preview_webp"
+	AssetPreviewMP4  AssetKind = "preview_mp4"
+	// Image of an audio-only version's waveform
+	AssetWaveform AssetKind = "waveform"
+	// JSON summary of the audio for drawing waveforms; see package peaks
+	AssetPeaks AssetKind = "peaks"
+	// The media as uploaded, before a watermark was applied. It's only for the
+	// owner, so isn't listed with the video's other assets.
+	AssetOriginal AssetKind = "original"
+)
+
+// Assets of the active version for videoColumns, as a JSON object of kind to
+// URL
+const videoAssetsColumn = `
+		(
+			SELECT json_group_object(kind, url)
+			FROM version_assets
+			WHERE version_assets.version_id = videos.active_version_id AND kind != 'original'
+		)`
+
+func parseVideoAssets(assets *string) (map[AssetKind]string, error) {
+	videoAssets := map[AssetKind]string{}
+	if assets == nil {
+		return videoAssets, nil
+	}
+	err := json.Unmarshal([]byte(*assets), &videoAssets)
+	return videoAssets, err
+}
+
+// SetVersionAsset records a derived file for the version, replacing any
+// earlier one of the same kind.
+func (c Client) SetVersionAsset(versionID uuid.UUID, kind AssetKind, url string) error {
+	query := `
+	INSERT INTO version_assets (version_id, kind, url, created_at)
+	VALUES (?, ?, ?, CURRENT_TIMESTAMP)
+	ON CONFLICT(version_id, kind) DO UPDATE SET
+		url = excluded.url,
+		created_at = excluded.created_at
+	`
+	_, err := c.db.Exec(query, versionID, kind, url)
+	return err
+}
+
+// GetVersionAsset returns the URL of the version's asset of the given kind, or
+// an empty string if it doesn't have one.
+func (c Client) GetVersionAsset(versionID uuid.UUID, kind AssetKind) (string, error) {
+	query := `
+	SELECT url
+	FROM version_assets
+	WHERE version_id = ? AND kind = ?
+	`
+	var url string
+	err := c.db.QueryRow(query, versionID, kind).Scan(&url)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil
+		}
+		return "", err
+	}
+
+	return url, nil
+}
+
+// GetVideoAssetURLs lists the URLs of every derived file of every version of
+// the video, including caption tracks extracted from its media.
+func (c Client) GetVideoAssetURLs(videoID uuid.UUID) ([]string, error) {
+	query := `
+	SELECT version_assets.url
+	FROM version_assets
+	JOIN video_versions ON video_versions.id = version_assets.version_id
+	WHERE video_versions.video_id = ?
+	UNION ALL
+	SELECT version_caption_tracks.url
+	FROM version_caption_tracks
+	JOIN video_versions ON video_versions.id = version_caption_tracks.version_id
+	WHERE video_versions.video_id = ?
+	`
+	rows, err := c.db.Query(query, videoID, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	urls := []string{}
+	for rows.Next() {
+		var url string
+		if err := rows.Scan(&url); err != nil {
+			return nil, err
+		}
+		urls = append(urls, url)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return urls, nil
+}
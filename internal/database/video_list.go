@@ -0,0 +1,238 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type VideoSort string
+
+const (
+	VideoSortCreated  VideoSort = "created"
+	VideoSortUpdated  VideoSort = "updated"
+	VideoSortTitle    VideoSort = "title"
+	VideoSortDuration VideoSort = "duration"
+)
+
+// Expression each sort key orders by. Duration is coalesced so that videos
+// without content yet still have a comparable value for the cursor.
+var videoSortExpressions = map[VideoSort]string{
+	VideoSortCreated:  "created_at",
+	VideoSortUpdated:  updatedAtMillisExpr,
+	VideoSortTitle:    "title COLLATE NOCASE",
+	VideoSortDuration: "COALESCE(duration, -1)",
+}
+
+// Direction used when the caller doesn't ask for one
+var videoSortDefaultDescending = map[VideoSort]bool{
+	VideoSortCreated:  true,
+	VideoSortUpdated:  true,
+	VideoSortTitle:    false,
+	VideoSortDuration: true,
+}
+
+// Matches the text SQLite stores for CURRENT_TIMESTAMP, so comparisons
+// against our timestamp columns stay lexicographically correct
+const sqliteTimestampFormat = "2006-01-02 15:04:05"
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+var ErrInvalidSort = errors.New("invalid sort")
+
+type ListVideosParams struct {
+	UserID        uuid.UUID
+	Limit         int
+	Cursor        string
+	Sort          VideoSort
+	Descending    *bool
+	Status        VideoStatus
+	HasVideo      *bool
+	HasThumbnail  *bool
+	AspectClass   string
+	MediaKind     MediaKind
+	Tag           string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+}
+
+type VideoPage struct {
+	Videos     []Video `json:"videos"`
+	NextCursor string  `json:"next_cursor,omitempty"`
+	Total      int     `json:"total"`
+}
+
+// videoCursor is the decoded form of the opaque cursor handed to clients. It
+// records the sort it was issued for so it can't be replayed against another.
+type videoCursor struct {
+	Sort       VideoSort `json:"s"`
+	Descending bool      `json:"d"`
+	Value      any       `json:"v"`
+	ID         uuid.UUID `json:"id"`
+}
+
+func encodeVideoCursor(cursor videoCursor) (string, error) {
+	dat, err := json.Marshal(cursor)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(dat), nil
+}
+
+func decodeVideoCursor(s string) (videoCursor, error) {
+	dat, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return videoCursor{}, ErrInvalidCursor
+	}
+	var cursor videoCursor
+	if err := json.Unmarshal(dat, &cursor); err != nil {
+		return videoCursor{}, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+func videoSortValue(video Video, sort VideoSort) any {
+	switch sort {
+	case VideoSortUpdated:
+		return video.UpdatedAt.UTC().Format(sqliteTimestampMillisFormat)
+	case VideoSortTitle:
+		return video.Title
+	case VideoSortDuration:
+		if video.Duration == nil {
+			return -1.0
+		}
+		return *video.Duration
+	default:
+		return video.CreatedAt.UTC().Format(sqliteTimestampFormat)
+	}
+}
+
+func (c Client) GetVideos(params ListVideosParams) (VideoPage, error) {
+	if params.Sort == "" {
+		params.Sort = VideoSortCreated
+	}
+	sortExpr, ok := videoSortExpressions[params.Sort]
+	if !ok {
+		return VideoPage{}, ErrInvalidSort
+	}
+	descending := videoSortDefaultDescending[params.Sort]
+	if params.Descending != nil {
+		descending = *params.Descending
+	}
+
+	conditions := []string{"user_id = ?", "deleted_at IS NULL"}
+	args := []any{params.UserID}
+	if params.Status != "" {
+		conditions = append(conditions, "status = ?")
+		args = append(args, params.Status)
+	}
+	if params.HasVideo != nil {
+		conditions = append(conditions, nullCondition("video_url", *params.HasVideo))
+	}
+	if params.HasThumbnail != nil {
+		conditions = append(conditions, nullCondition("thumbnail_url", *params.HasThumbnail))
+	}
+	if params.AspectClass != "" {
+		conditions = append(conditions, "aspect_class = ?")
+		args = append(args, params.AspectClass)
+	}
+	if params.MediaKind != "" {
+		conditions = append(conditions, "media_kind = ?")
+		args = append(args, params.MediaKind)
+	}
+	if params.Tag != "" {
+		conditions = append(conditions, `EXISTS (
+			SELECT 1
+			FROM video_tags
+			JOIN tags ON tags.id = video_tags.tag_id
+			WHERE video_tags.video_id = videos.id AND tags.name = ?
+		)`)
+		args = append(args, params.Tag)
+	}
+	if params.CreatedAfter != nil {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, params.CreatedAfter.UTC().Format(sqliteTimestampFormat))
+	}
+	if params.CreatedBefore != nil {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, params.CreatedBefore.UTC().Format(sqliteTimestampFormat))
+	}
+
+	page := VideoPage{Videos: []Video{}}
+	countQuery := "SELECT COUNT(*) FROM videos WHERE " + strings.Join(conditions, " AND ")
+	err := c.db.QueryRow(countQuery, args...).Scan(&page.Total)
+	if err != nil {
+		return VideoPage{}, err
+	}
+
+	direction, comparison := "ASC", ">"
+	if descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	if params.Cursor != "" {
+		cursor, err := decodeVideoCursor(params.Cursor)
+		if err != nil {
+			return VideoPage{}, err
+		}
+		if cursor.Sort != params.Sort || cursor.Descending != descending {
+			return VideoPage{}, ErrInvalidCursor
+		}
+		conditions = append(conditions, fmt.Sprintf("(%[1]s %[2]s ? OR (%[1]s = ? AND id %[2]s ?))", sortExpr, comparison))
+		args = append(args, cursor.Value, cursor.Value, cursor.ID)
+	}
+
+	// Fetch one extra row to find out whether there's another page
+	query := `
+	SELECT` + videoColumns + `
+	FROM videos
+	WHERE ` + strings.Join(conditions, " AND ") + `
+	ORDER BY ` + sortExpr + ` ` + direction + `, id ` + direction + `
+	LIMIT ?
+	`
+	args = append(args, params.Limit+1)
+
+	rows, err := c.db.Query(query, args...)
+	if err != nil {
+		return VideoPage{}, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		video, err := scanVideo(rows)
+		if err != nil {
+			return VideoPage{}, err
+		}
+		page.Videos = append(page.Videos, video)
+	}
+	if err := rows.Err(); err != nil {
+		return VideoPage{}, err
+	}
+
+	if len(page.Videos) > params.Limit {
+		page.Videos = page.Videos[:params.Limit]
+		last := page.Videos[len(page.Videos)-1]
+		page.NextCursor, err = encodeVideoCursor(videoCursor{
+			Sort:       params.Sort,
+			Descending: descending,
+			Value:      videoSortValue(last, params.Sort),
+			ID:         last.ID,
+		})
+		if err != nil {
+			return VideoPage{}, err
+		}
+	}
+
+	return page, nil
+}
+
+func nullCondition(column string, present bool) string {
+	if present {
+		return column + " IS NOT NULL"
+	}
+	return column + " IS NULL"
+}
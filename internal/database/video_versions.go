@@ -0,0 +1,231 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// VideoVersion is one upload of a video's media. Re-uploading adds a version
+// rather than replacing the last one, so owners can roll back.
+type VideoVersion struct {
+	ID        uuid.UUID `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	// Numbered from 1 per video in upload order
+	Version int  `json:"version"`
+	Active  bool `json:"active"`
+	CreateVideoVersionParams
+}
+
+type CreateVideoVersionParams struct {
+	VideoID     uuid.UUID `json:"video_id"`
+	StorageKey  string    `json:"storage_key"`
+	MediaKind   MediaKind `json:"media_kind"`
+	Duration    *float64  `json:"duration"`
+	AspectClass *string   `json:"aspect_class"`
+	// Measured before normalisation, if the upload was normalised
+	IntegratedLoudness *float64  `json:"integrated_loudness"`
+	TruePeak           *float64  `json:"true_peak"`
+	SizeBytes          int64     `json:"size_bytes"`
+	UploadedBy         uuid.UUID `json:"uploaded_by"`
+}
+
+const videoVersionColumns = `
+		video_versions.id,
+		video_versions.created_at,
+		video_versions.version,
+		video_versions.id = videos.active_version_id,
+		video_versions.video_id,
+		video_versions.storage_key,
+		video_versions.media_kind,
+		video_versions.duration,
+		video_versions.aspect_class,
+		video_versions.integrated_loudness,
+		video_versions.true_peak,
+		video_versions.size_bytes,
+		video_versions.uploaded_by`
+
+func scanVideoVersion(row rowScanner) (VideoVersion, error) {
+	var version VideoVersion
+	var active sql.NullBool
+	err := row.Scan(
+		&version.ID,
+		&version.CreatedAt,
+		&version.Version,
+		&active,
+		&version.VideoID,
+		&version.StorageKey,
+		&version.MediaKind,
+		&version.Duration,
+		&version.AspectClass,
+		&version.IntegratedLoudness,
+		&version.TruePeak,
+		&version.SizeBytes,
+		&version.UploadedBy,
+	)
+	version.Active = active.Bool
+	return version, err
+}
+
+// CreateVideoVersion records a new upload as the video's next version. It
+// doesn't make it active; see ActivateVideoVersion.
+func (c Client) CreateVideoVersion(params CreateVideoVersionParams) (VideoVersion, error) {
+	id := uuid.New()
+	query := `
+	INSERT INTO video_versions (
+		id,
+		video_id,
+		version,
+		storage_key,
+		media_kind,
+		duration,
+		aspect_class,
+		integrated_loudness,
+		true_peak,
+		size_bytes,
+		uploaded_by,
+		created_at
+	) VALUES (
+		?,
+		?,
+		(SELECT COALESCE(MAX(version), 0) + 1 FROM video_versions WHERE video_id = ?),
+		?, ?, ?, ?, ?, ?, ?, ?,
+		CURRENT_TIMESTAMP
+	)
+	`
+	_, err := c.db.Exec(
+		query,
+		id,
+		params.VideoID,
+		params.VideoID,
+		params.StorageKey,
+		params.MediaKind,
+		params.Duration,
+		params.AspectClass,
+		params.IntegratedLoudness,
+		params.TruePeak,
+		params.SizeBytes,
+		params.UploadedBy,
+	)
+	if err != nil {
+		return VideoVersion{}, err
+	}
+
+	return c.GetVideoVersion(params.VideoID, id)
+}
+
+func (c Client) GetVideoVersion(videoID, id uuid.UUID) (VideoVersion, error) {
+	query := `
+	SELECT` + videoVersionColumns + `
+	FROM video_versions
+	JOIN videos ON videos.id = video_versions.video_id
+	WHERE video_versions.video_id = ? AND video_versions.id = ?
+	`
+	version, err := scanVideoVersion(c.db.QueryRow(query, videoID, id))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return VideoVersion{}, nil
+		}
+		return VideoVersion{}, err
+	}
+
+	return version, nil
+}
+
+// GetVideoVersions lists a video's versions, newest first.
+func (c Client) GetVideoVersions(videoID uuid.UUID) ([]VideoVersion, error) {
+	query := `
+	SELECT` + videoVersionColumns + `
+	FROM video_versions
+	JOIN videos ON videos.id = video_versions.video_id
+	WHERE video_versions.video_id = ?
+	ORDER BY video_versions.version DESC
+	`
+	rows, err := c.db.Query(query, videoID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []VideoVersion{}
+	for rows.Next() {
+		version, err := scanVideoVersion(rows)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return versions, nil
+}
+
+// ActivateVideoVersion points the video at one of its versions, copying the
+// version's media details onto it. videoURL is where the version's media is
+// served from.
+func (c Client) ActivateVideoVersion(version VideoVersion, videoURL string) error {
+	query := `
+	UPDATE videos
+	SET
+		updated_at = ` + sqliteNowMillis + `,
+		active_version_id = ?,
+		video_url = ?,
+		media_kind = ?,
+		duration = ?,
+		aspect_class = ?,
+		integrated_loudness = ?,
+		true_peak = ?,
+		status = ?
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(
+		query,
+		version.ID,
+		videoURL,
+		version.MediaKind,
+		version.Duration,
+		version.AspectClass,
+		version.IntegratedLoudness,
+		version.TruePeak,
+		VideoStatusReady,
+		version.VideoID,
+	)
+	return err
+}
+
+// ReplaceVideoVersionMedia points a version at a new copy of its media, such
+// as one with updated metadata, updating the video too if the version is
+// active. It returns the storage key of the copy being replaced.
+func (c Client) ReplaceVideoVersionMedia(versionID uuid.UUID, storageKey string, sizeBytes int64, videoURL string) (string, error) {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return "", err
+	}
+	defer tx.Rollback()
+
+	var previousKey string
+	err = tx.QueryRow("SELECT storage_key FROM video_versions WHERE id = ?", versionID).Scan(&previousKey)
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.Exec("UPDATE video_versions SET storage_key = ?, size_bytes = ? WHERE id = ?", storageKey, sizeBytes, versionID)
+	if err != nil {
+		return "", err
+	}
+	_, err = tx.Exec(`
+	UPDATE videos
+	SET
+		updated_at = `+sqliteNowMillis+`,
+		video_url = ?
+	WHERE active_version_id = ?
+	`, videoURL, versionID)
+	if err != nil {
+		return "", err
+	}
+
+	return previousKey, tx.Commit()
+}
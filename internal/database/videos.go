@@ -8,24 +8,64 @@ import (
 	"github.com/google/uuid"
 )
 
+type VideoStatus string
+
+const (
+	VideoStatusDraft      VideoStatus = "draft"
+	VideoStatusProcessing VideoStatus = "processing"
+	VideoStatusReady      VideoStatus = "ready"
+	VideoStatusFailed     VideoStatus = "failed"
+)
+
 type Video struct {
-	ID           uuid.UUID `json:"id"`
-	CreatedAt    time.Time `json:"created_at"`
-	UpdatedAt    time.Time `json:"updated_at"`
-	ThumbnailURL *string   `json:"thumbnail_url"`
-	VideoURL     *string   `json:"video_url"`
+	ID           uuid.UUID   `json:"id"`
+	CreatedAt    time.Time   `json:"created_at"`
+	UpdatedAt    time.Time   `json:"updated_at"`
+	ThumbnailURL *string     `json:"thumbnail_url"`
+	VideoURL     *string     `json:"video_url"`
+	Status       VideoStatus `json:"status"`
+	// Whether the active version is a video or audio only
+	MediaKind   MediaKind `json:"media_kind"`
+	Duration    *float64  `json:"duration"`
+	AspectClass *string   `json:"aspect_class"`
+	// Loudness of the upload before normalisation, in LUFS and dBTP; only
+	// measured when the uploader asked for it to be normalised
+	IntegratedLoudness *float64         `json:"integrated_loudness"`
+	TruePeak           *float64         `json:"true_peak"`
+	Tags               []string         `json:"tags"`
+	Reactions          map[Reaction]int `json:"reactions"`
+	Captions           []CaptionTrack   `json:"captions"`
+	AudioTracks        []AudioTrack     `json:"audio_tracks"`
+	Chapters           []Chapter        `json:"chapters"`
+	// Files derived from the active version, such as preview sprites
+	Assets          map[AssetKind]string `json:"assets"`
+	CommentsEnabled bool                 `json:"comments_enabled"`
+	// A scheduled video stays private until PublishAt, when the scheduler
+	// switches it to PublishVisibility
+	PublishAt         *time.Time  `json:"publish_at"`
+	PublishVisibility *Visibility `json:"publish_visibility"`
+	// Set while the video is in the trash
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// The upload VideoURL, Duration and AspectClass currently come from
+	ActiveVersionID *uuid.UUID `json:"active_version_id"`
 	CreateVideoParams
 }
 
 type CreateVideoParams struct {
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	UserID      uuid.UUID `json:"user_id"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Visibility  Visibility `json:"visibility"`
+	UserID      uuid.UUID  `json:"user_id"`
 }
 
-func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
-	query := `
-	SELECT
+// CanBeViewedBy reports whether userID (uuid.Nil for anonymous requests) may
+// see the video. Unlisted videos are viewable by anyone who has the ID.
+func (v Video) CanBeViewedBy(userID uuid.UUID) bool {
+	return v.UserID == userID || v.Visibility != VisibilityPrivate
+}
+
+// Column list shared by every query that scans a full Video via scanVideo
+const videoColumns = `
 		id,
 		created_at,
 		updated_at,
@@ -33,37 +73,80 @@ func (c Client) GetVideos(userID uuid.UUID) ([]Video, error) {
 		description,
 		thumbnail_url,
 		video_url,
-		user_id
-	FROM videos
-	WHERE user_id = ?
-	ORDER BY created_at DESC
-	`
+		user_id,
+		status,
+		media_kind,
+		duration,
+		aspect_class,
+		integrated_loudness,
+		true_peak,
+		visibility,
+		comments_enabled,
+		publish_at,
+		publish_visibility,
+		deleted_at,
+		active_version_id,` + videoTagsColumn + `,` + videoReactionsColumn + `,` + videoCaptionsColumn + `,` + videoAudioTracksColumn + `,` + videoChaptersColumn + `,` + videoAssetsColumn
 
-	rows, err := c.db.Query(query, userID)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-
-	videos := []Video{}
-	for rows.Next() {
-		var video Video
-		if err := rows.Scan(
-			&video.ID,
-			&video.CreatedAt,
-			&video.UpdatedAt,
-			&video.Title,
-			&video.Description,
-			&video.ThumbnailURL,
-			&video.VideoURL,
-			&video.UserID,
-		); err != nil {
-			return nil, err
-		}
-		videos = append(videos, video)
-	}
+type rowScanner interface {
+	Scan(dest ...any) error
+}
 
-	return videos, nil
+// scanVideo scans the columns in videoColumns, followed by any extra columns
+// the query selected into extra.
+func scanVideo(row rowScanner, extra ...any) (Video, error) {
+	var video Video
+	var tags, reactions, captions, audioTracks, chapters, assets *string
+	dest := []any{
+		&video.ID,
+		&video.CreatedAt,
+		&video.UpdatedAt,
+		&video.Title,
+		&video.Description,
+		&video.ThumbnailURL,
+		&video.VideoURL,
+		&video.UserID,
+		&video.Status,
+		&video.MediaKind,
+		&video.Duration,
+		&video.AspectClass,
+		&video.IntegratedLoudness,
+		&video.TruePeak,
+		&video.Visibility,
+		&video.CommentsEnabled,
+		&video.PublishAt,
+		&video.PublishVisibility,
+		&video.DeletedAt,
+		&video.ActiveVersionID,
+		&tags,
+		&reactions,
+		&captions,
+		&audioTracks,
+		&chapters,
+		&assets,
+	}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return video, err
+	}
+	video.Tags = splitTags(tags)
+	video.Reactions, err = parseReactionCounts(reactions)
+	if err != nil {
+		return video, err
+	}
+	video.Captions, err = parseCaptionTracks(captions)
+	if err != nil {
+		return video, err
+	}
+	video.AudioTracks, err = parseAudioTracks(audioTracks)
+	if err != nil {
+		return video, err
+	}
+	video.Chapters, err = parseChapters(chapters)
+	if err != nil {
+		return video, err
+	}
+	video.Assets, err = parseVideoAssets(assets)
+	return video, err
 }
 
 func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
@@ -75,10 +158,15 @@ func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
 		updated_at,
 		title,
 		description,
-		user_id
-	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?)
+		user_id,
+		status,
+		visibility
+	) VALUES (?, CURRENT_TIMESTAMP, CURRENT_TIMESTAMP, ?, ?, ?, ?, ?)
 	`
-	_, err := c.db.Exec(query, id, params.Title, params.Description, params.UserID)
+	if params.Visibility == "" {
+		params.Visibility = VisibilityPrivate
+	}
+	_, err := c.db.Exec(query, id, params.Title, params.Description, params.UserID, VideoStatusDraft, params.Visibility)
 	if err != nil {
 		return Video{}, err
 	}
@@ -86,31 +174,29 @@ func (c Client) CreateVideo(params CreateVideoParams) (Video, error) {
 	return c.GetVideo(id)
 }
 
+// GetVideo doesn't return videos that are in the trash.
 func (c Client) GetVideo(id uuid.UUID) (Video, error) {
+	return c.getVideo(id, false)
+}
+
+// GetTrashedVideo only returns the video if it's in the trash.
+func (c Client) GetTrashedVideo(id uuid.UUID) (Video, error) {
+	return c.getVideo(id, true)
+}
+
+func (c Client) getVideo(id uuid.UUID, trashed bool) (Video, error) {
 	query := `
-	SELECT
-		id,
-		created_at,
-		updated_at,
-		title,
-		description,
-		thumbnail_url,
-		video_url,
-		user_id
+	SELECT` + videoColumns + `
 	FROM videos
 	WHERE id = ?
 	`
+	if trashed {
+		query += " AND deleted_at IS NOT NULL"
+	} else {
+		query += " AND deleted_at IS NULL"
+	}
 
-	var video Video
-	err := c.db.QueryRow(query, id).Scan(
-		&video.ID,
-		&video.CreatedAt,
-		&video.UpdatedAt,
-		&video.Title,
-		&video.Description,
-		&video.ThumbnailURL,
-		&video.VideoURL,
-		&video.UserID)
+	video, err := scanVideo(c.db.QueryRow(query, id))
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return Video{}, nil
@@ -121,35 +207,158 @@ func (c Client) GetVideo(id uuid.UUID) (Video, error) {
 	return video, nil
 }
 
+// SQLite's CURRENT_TIMESTAMP only has second resolution, which is too coarse
+// for updated_at to serve as a version for optimistic concurrency
+const sqliteNowMillis = "strftime('%Y-%m-%d %H:%M:%f', 'now')"
+
+// Comparable form of updated_at for both legacy second-resolution values and
+// those written with sqliteNowMillis
+const updatedAtMillisExpr = "strftime('%Y-%m-%d %H:%M:%f', updated_at)"
+
+const sqliteTimestampMillisFormat = "2006-01-02 15:04:05.000"
+
 func (c Client) UpdateVideo(video Video) error {
+	_, err := c.updateVideo(video, nil)
+	return err
+}
+
+// UpdateVideoIfUnmodified only applies the update if the stored updated_at
+// still matches expectedUpdatedAt, reporting whether it did.
+func (c Client) UpdateVideoIfUnmodified(video Video, expectedUpdatedAt time.Time) (bool, error) {
+	return c.updateVideo(video, &expectedUpdatedAt)
+}
+
+func (c Client) updateVideo(video Video, expectedUpdatedAt *time.Time) (bool, error) {
 	query := `
 	UPDATE videos
 	SET
+		updated_at = ` + sqliteNowMillis + `,
 		title = ?,
 		description = ?,
 		thumbnail_url = ?,
 		video_url = ?,
-		user_id = ?
+		user_id = ?,
+		status = ?,
+		duration = ?,
+		aspect_class = ?,
+		visibility = ?,
+		comments_enabled = ?,
+		publish_at = ?,
+		publish_visibility = ?
 	WHERE id = ?
 	`
-
-	_, err := c.db.Exec(
-		query,
+	args := []any{
 		video.Title,
 		video.Description,
-		&video.ThumbnailURL,
-		&video.VideoURL,
+		video.ThumbnailURL,
+		video.VideoURL,
 		video.UserID,
+		video.Status,
+		video.Duration,
+		video.AspectClass,
+		video.Visibility,
+		video.CommentsEnabled,
+		formatOptionalTimestamp(video.PublishAt),
+		video.PublishVisibility,
 		video.ID,
-	)
+	}
+	if expectedUpdatedAt != nil {
+		query += " AND " + updatedAtMillisExpr + " = ?"
+		args = append(args, expectedUpdatedAt.UTC().Format(sqliteTimestampMillisFormat))
+	}
+
+	result, err := c.db.Exec(query, args...)
+	if err != nil {
+		return false, err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return affected > 0, nil
+}
+
+func (c Client) SetVideoStatus(id uuid.UUID, status VideoStatus) error {
+	query := `
+	UPDATE videos
+	SET status = ?, updated_at = ` + sqliteNowMillis + `
+	WHERE id = ?
+	`
+	_, err := c.db.Exec(query, status, id)
 	return err
 }
 
+// DeleteVideo permanently deletes the video and everything attached to it.
+// Users delete videos with TrashVideo; this is for purging the trash.
 func (c Client) DeleteVideo(id uuid.UUID) error {
+	tx, err := c.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec("DELETE FROM share_links WHERE video_id = ?", id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM video_tags WHERE video_id = ?", id)
+	if err != nil {
+		return err
+	}
+	err = deleteUnusedTags(tx)
+	if err != nil {
+		return err
+	}
+	err = removeVideoFromPlaylists(tx, id)
+	if err != nil {
+		return err
+	}
+	err = deleteVideoAnalytics(tx, id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM watch_progress WHERE video_id = ?", id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM comments WHERE video_id = ?", id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM video_reactions WHERE video_id = ?", id)
+	if err != nil {
+		return err
+	}
+	for _, table := range []string{"version_assets", "version_audio_tracks", "version_caption_tracks"} {
+		_, err = tx.Exec("DELETE FROM "+table+" WHERE version_id IN (SELECT id FROM video_versions WHERE video_id = ?)", id)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec("DELETE FROM video_versions WHERE video_id = ?", id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM caption_tracks WHERE video_id = ?", id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM chapters WHERE video_id = ?", id)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("DELETE FROM processing_jobs WHERE video_id = ?", id)
+	if err != nil {
+		return err
+	}
+
 	query := `
 	DELETE FROM videos
 	WHERE id = ?
 	`
-	_, err := c.db.Exec(query, id)
-	return err
+	_, err = tx.Exec(query, id)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
 }
@@ -0,0 +1,104 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type WatchProgress struct {
+	VideoID   uuid.UUID `json:"video_id"`
+	Position  float64   `json:"position"`
+	Completed bool      `json:"completed"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type ContinueWatchingItem struct {
+	Video     Video     `json:"video"`
+	Position  float64   `json:"position"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (c Client) SetWatchProgress(userID, videoID uuid.UUID, position float64, completed bool) (WatchProgress, error) {
+	query := `
+	INSERT INTO watch_progress (user_id, video_id, position, completed, updated_at)
+	VALUES (?, ?, ?, ?, ` + sqliteNowMillis + `)
+	ON CONFLICT(user_id, video_id) DO UPDATE SET
+		position = excluded.position,
+		completed = excluded.completed,
+		updated_at = excluded.updated_at
+	`
+	_, err := c.db.Exec(query, userID, videoID, position, completed)
+	if err != nil {
+		return WatchProgress{}, err
+	}
+
+	return c.GetWatchProgress(userID, videoID)
+}
+
+// GetWatchProgress returns a zero WatchProgress if the user hasn't watched
+// the video.
+func (c Client) GetWatchProgress(userID, videoID uuid.UUID) (WatchProgress, error) {
+	query := `
+	SELECT video_id, position, completed, updated_at
+	FROM watch_progress
+	WHERE user_id = ? AND video_id = ?
+	`
+	var progress WatchProgress
+	err := c.db.QueryRow(query, userID, videoID).Scan(
+		&progress.VideoID,
+		&progress.Position,
+		&progress.Completed,
+		&progress.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return WatchProgress{}, nil
+		}
+		return WatchProgress{}, err
+	}
+
+	return progress, nil
+}
+
+// GetContinueWatching lists videos the user has started but not finished,
+// most recently watched first, skipping any they can no longer view.
+func (c Client) GetContinueWatching(userID uuid.UUID, limit int) ([]ContinueWatchingItem, error) {
+	query := `
+	WITH progress AS (
+		SELECT video_id, position, updated_at AS watched_at
+		FROM watch_progress
+		WHERE user_id = ? AND completed = 0
+	)
+	SELECT` + videoColumns + `,
+		progress.position,
+		progress.watched_at
+	FROM videos
+	JOIN progress ON progress.video_id = videos.id
+	WHERE deleted_at IS NULL AND (user_id = ? OR visibility != ?)
+	ORDER BY progress.watched_at DESC
+	LIMIT ?
+	`
+	rows, err := c.db.Query(query, userID, userID, VisibilityPrivate, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	items := []ContinueWatchingItem{}
+	for rows.Next() {
+		var item ContinueWatchingItem
+		item.Video, err = scanVideo(rows, &item.Position, &item.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
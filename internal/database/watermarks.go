@@ -0,0 +1,65 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Watermark is a user's default watermark for their uploads.
+type Watermark struct {
+	UserID    uuid.UUID `json:"user_id"`
+	URL       string    `json:"url"`
+	Position  string    `json:"position"`
+	Opacity   float64   `json:"opacity"`
+	Scale     float64   `json:"scale"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// SetWatermark replaces the user's watermark.
+func (c Client) SetWatermark(watermark Watermark) error {
+	query := `
+	INSERT INTO watermarks (user_id, url, position, opacity, scale, updated_at)
+	VALUES (?, ?, ?, ?, ?, CURRENT_TIMESTAMP)
+	ON CONFLICT(user_id) DO UPDATE SET
+		url = excluded.url,
+		position = excluded.position,
+		opacity = excluded.opacity,
+		scale = excluded.scale,
+		updated_at = excluded.updated_at
+	`
+	_, err := c.db.Exec(query, watermark.UserID, watermark.URL, watermark.Position, watermark.Opacity, watermark.Scale)
+	return err
+}
+
+func (c Client) GetWatermark(userID uuid.UUID) (Watermark, error) {
+	query := `
+	SELECT user_id, url, position, opacity, scale, updated_at
+	FROM watermarks
+	WHERE user_id = ?
+	`
+	var watermark Watermark
+	err := c.db.QueryRow(query, userID).Scan(
+		&watermark.UserID,
+		&watermark.URL,
+		&watermark.Position,
+		&watermark.Opacity,
+		&watermark.Scale,
+		&watermark.UpdatedAt,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Watermark{}, nil
+		}
+		return Watermark{}, err
+	}
+
+	return watermark, nil
+}
+
+func (c Client) DeleteWatermark(userID uuid.UUID) error {
+	_, err := c.db.Exec("DELETE FROM watermarks WHERE user_id = ?", userID)
+	return err
+}
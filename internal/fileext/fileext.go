@@ -10,6 +10,8 @@ func FromMediaType(contentType string) string {
 		return ".gif"
 	case "video/mp4":
 		return ".mp4"
+	case "audio/mp4":
+		return ".m4a"
 	default:
 		return ""
 	}
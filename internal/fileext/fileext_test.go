@@ -11,6 +11,7 @@ func TestFromContentType(t *testing.T) {
         {"image/png", ".png"},
         {"image/gif", ".gif"},
         {"video/mp4", ".mp4"},
+        {"audio/mp4", ".m4a"},
         {"image/webp", ""},
         {"application/json", ""},
         {"", ""},
@@ -0,0 +1,124 @@
+// Package loudness builds ffmpeg loudnorm filters for two-pass EBU R128
+// normalisation and parses the measurements loudnorm reports.
+package loudness
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Target is what normalised audio is brought to.
+type Target struct {
+	// Integrated loudness in LUFS
+	Integrated float64
+	// Maximum true peak in dBTP
+	TruePeak float64
+	// Loudness range in LU
+	Range float64
+}
+
+// EBU R128 broadcast recommendation.
+var Default = Target{Integrated: -23, TruePeak: -1, Range: 7}
+
+// Measurement is what the first loudnorm pass reports about its input.
+type Measurement struct {
+	// Integrated loudness in LUFS
+	Integrated float64
+	// True peak in dBTP
+	TruePeak float64
+	// Loudness range in LU
+	Range float64
+	// Gating threshold in LUFS
+	Threshold float64
+	// Offset gain for the second pass in LU
+	TargetOffset float64
+}
+
+var (
+	// ErrNoMeasurement means ffmpeg's output had no loudnorm report in it.
+	ErrNoMeasurement = errors.New("no loudnorm measurement found")
+	// ErrSilent means the audio is too quiet to measure, so there's nothing
+	// to normalise.
+	ErrSilent = errors.New("audio is silent")
+)
+
+// MeasureFilter is the audio filter for the first pass, which only analyses
+// the input and prints a Measurement to stderr.
+func (t Target) MeasureFilter() string {
+	return t.params() + ":print_format=json"
+}
+
+// NormalizeFilter is the audio filter for the second pass, which uses the
+// first pass's measurement to normalise linearly where it can.
+func (t Target) NormalizeFilter(m Measurement) string {
+	return fmt.Sprintf("%s:measured_I=%s:measured_TP=%s:measured_LRA=%s:measured_thresh=%s:offset=%s:linear=true:print_format=summary",
+		t.params(),
+		formatValue(m.Integrated),
+		formatValue(m.TruePeak),
+		formatValue(m.Range),
+		formatValue(m.Threshold),
+		formatValue(m.TargetOffset))
+}
+
+func (t Target) params() string {
+	return fmt.Sprintf("loudnorm=I=%s:TP=%s:LRA=%s", formatValue(t.Integrated), formatValue(t.TruePeak), formatValue(t.Range))
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
+
+// ParseMeasurement finds the JSON report loudnorm prints at the end of a
+// first pass in ffmpeg's stderr.
+func ParseMeasurement(output []byte) (Measurement, error) {
+	start := bytes.LastIndexByte(output, '{')
+	if start < 0 {
+		return Measurement{}, ErrNoMeasurement
+	}
+	end := bytes.IndexByte(output[start:], '}')
+	if end < 0 {
+		return Measurement{}, ErrNoMeasurement
+	}
+
+	// loudnorm reports every value as a string
+	var report struct {
+		InputI       string `json:"input_i"`
+		InputTP      string `json:"input_tp"`
+		InputLRA     string `json:"input_lra"`
+		InputThresh  string `json:"input_thresh"`
+		TargetOffset string `json:"target_offset"`
+	}
+	err := json.Unmarshal(output[start:start+end+1], &report)
+	if err != nil {
+		return Measurement{}, fmt.Errorf("%w: %v", ErrNoMeasurement, err)
+	}
+	if report.InputI == "" {
+		return Measurement{}, ErrNoMeasurement
+	}
+	if report.InputI == "-inf" {
+		return Measurement{}, ErrSilent
+	}
+
+	m := Measurement{}
+	fields := []struct {
+		name  string
+		value string
+		dest  *float64
+	}{
+		{"input_i", report.InputI, &m.Integrated},
+		{"input_tp", report.InputTP, &m.TruePeak},
+		{"input_lra", report.InputLRA, &m.Range},
+		{"input_thresh", report.InputThresh, &m.Threshold},
+		{"target_offset", report.TargetOffset, &m.TargetOffset},
+	}
+	for _, field := range fields {
+		*field.dest, err = strconv.ParseFloat(field.value, 64)
+		if err != nil {
+			return Measurement{}, fmt.Errorf("invalid %s %q", field.name, field.value)
+		}
+	}
+	return m, nil
+}
@@ -0,0 +1,71 @@
+package loudness
+
+import (
+	"errors"
+	"testing"
+)
+
+const firstPassOutput = `[Parsed_loudnorm_0 @ 0x5581c2a0e3c0]
+{
+	"input_i" : "-27.61",
+	"input_tp" : "-4.47",
+	"input_lra" : "18.06",
+	"input_thresh" : "-39.20",
+	"output_i" : "-22.98",
+	"output_tp" : "-1.00",
+	"output_lra" : "7.30",
+	"output_thresh" : "-33.93",
+	"normalization_type" : "dynamic",
+	"target_offset" : "-0.02"
+}
+`
+
+func TestParseMeasurement(t *testing.T) {
+	m, err := ParseMeasurement([]byte("size=N/A time=00:01:00.00 bitrate=N/A\n" + firstPassOutput))
+	if err != nil {
+		t.Fatalf("ParseMeasurement() error: %v", err)
+	}
+	expected := Measurement{Integrated: -27.61, TruePeak: -4.47, Range: 18.06, Threshold: -39.2, TargetOffset: -0.02}
+	if m != expected {
+		t.Errorf("ParseMeasurement() = %+v; want %+v", m, expected)
+	}
+}
+
+func TestParseMeasurementErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		expected error
+	}{
+		{"empty", "", ErrNoMeasurement},
+		{"no report", "Output #0, null, to 'pipe:':\n", ErrNoMeasurement},
+		{"unterminated", "{\n\t\"input_i\" : \"-27.61\",\n", ErrNoMeasurement},
+		{"silent", `{"input_i" : "-inf", "input_tp" : "-inf", "input_lra" : "0.00", "input_thresh" : "-70.00", "target_offset" : "inf"}`, ErrSilent},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseMeasurement([]byte(tt.output))
+		if !errors.Is(err, tt.expected) {
+			t.Errorf("%s: ParseMeasurement() error = %v; want %v", tt.name, err, tt.expected)
+		}
+	}
+}
+
+func TestMeasureFilter(t *testing.T) {
+	expected := "loudnorm=I=-23.00:TP=-1.00:LRA=7.00:print_format=json"
+	if result := Default.MeasureFilter(); result != expected {
+		t.Errorf("MeasureFilter() = %q; want %q", result, expected)
+	}
+}
+
+func TestNormalizeFilter(t *testing.T) {
+	target := Target{Integrated: -16, TruePeak: -1.5, Range: 11}
+	m := Measurement{Integrated: -27.61, TruePeak: -4.47, Range: 18.06, Threshold: -39.2, TargetOffset: -0.02}
+	expected := "loudnorm=I=-16.00:TP=-1.50:LRA=11.00" +
+		":measured_I=-27.61:measured_TP=-4.47:measured_LRA=18.06:measured_thresh=-39.20:offset=-0.02" +
+		":linear=true:print_format=summary"
+
+	if result := target.NormalizeFilter(m); result != expected {
+		t.Errorf("NormalizeFilter() = %q; want %q", result, expected)
+	}
+}
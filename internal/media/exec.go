@@ -0,0 +1,122 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"time"
+)
+
+// Config configures an ExecRunner. Zero values get sensible defaults.
+type Config struct {
+	// Paths to the binaries; by default they're looked up on PATH
+	FFmpegPath  string
+	FFprobePath string
+	// How long a job may run unless it sets its own timeout
+	Timeout time.Duration
+	// How many jobs may run at once; more wait their turn
+	MaxConcurrent int
+}
+
+const (
+	defaultTimeout       = 30 * time.Minute
+	defaultMaxConcurrent = 2
+)
+
+// ExecRunner runs jobs as child processes.
+type ExecRunner struct {
+	paths   map[Tool]string
+	timeout time.Duration
+	slots   chan struct{}
+}
+
+func NewExecRunner(config Config) *ExecRunner {
+	paths := map[Tool]string{FFmpeg: "ffmpeg", FFprobe: "ffprobe"}
+	if config.FFmpegPath != "" {
+		paths[FFmpeg] = config.FFmpegPath
+	}
+	if config.FFprobePath != "" {
+		paths[FFprobe] = config.FFprobePath
+	}
+	timeout := config.Timeout
+	if timeout <= 0 {
+		timeout = defaultTimeout
+	}
+	maxConcurrent := config.MaxConcurrent
+	if maxConcurrent <= 0 {
+		maxConcurrent = defaultMaxConcurrent
+	}
+	return &ExecRunner{
+		paths:   paths,
+		timeout: timeout,
+		slots:   make(chan struct{}, maxConcurrent),
+	}
+}
+
+func (r *ExecRunner) Run(ctx context.Context, job Job) ([]byte, error) {
+	path, ok := r.paths[job.Tool]
+	if !ok {
+		return nil, newError(job.Tool, fmt.Errorf("unknown tool %q", job.Tool), nil)
+	}
+	if err := checkProgress(job); err != nil {
+		return nil, newError(job.Tool, err, nil)
+	}
+
+	// Waiting for a slot counts against the caller's context but not the
+	// job's timeout
+	select {
+	case r.slots <- struct{}{}:
+		defer func() { <-r.slots }()
+	case <-ctx.Done():
+		return nil, newError(job.Tool, ctx.Err(), nil)
+	}
+
+	timeout := job.Timeout
+	if timeout <= 0 {
+		timeout = r.timeout
+	}
+	jobCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	args := job.Args
+	stdout := job.Stdout
+	var progressDone chan struct{}
+	if job.Progress != nil {
+		args = append([]string{"-progress", "pipe:1", "-nostats"}, args...)
+		progressReader, progressWriter := io.Pipe()
+		stdout = progressWriter
+		progressDone = make(chan struct{})
+		go func() {
+			defer close(progressDone)
+			ParseProgress(progressReader, job.Duration, job.Progress)
+			// Keep ffmpeg from blocking if parsing stopped early
+			io.Copy(io.Discard, progressReader)
+		}()
+		defer func() {
+			progressWriter.Close()
+			<-progressDone
+		}()
+	}
+
+	cmd := exec.CommandContext(jobCtx, path, args...)
+	stderr := bytes.Buffer{}
+	cmd.Stdout = stdout
+	cmd.Stderr = &stderr
+	// Don't wait forever on output pipes held open by grandchildren
+	cmd.WaitDelay = 5 * time.Second
+
+	err := cmd.Run()
+	if err != nil {
+		switch {
+		case ctx.Err() != nil:
+			err = ctx.Err()
+		case errors.Is(jobCtx.Err(), context.DeadlineExceeded):
+			err = fmt.Errorf("%w after %s", ErrTimeout, timeout)
+		}
+		return stderr.Bytes(), newError(job.Tool, err, stderr.Bytes())
+	}
+	return stderr.Bytes(), nil
+}
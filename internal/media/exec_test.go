@@ -0,0 +1,185 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// script writes a shell script standing in for a tool.
+func script(t *testing.T, body string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("needs a POSIX shell")
+	}
+	path := filepath.Join(t.TempDir(), "tool")
+	err := os.WriteFile(path, []byte("#!/bin/sh\n"+body+"\n"), 0o755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestExecRunnerOutput(t *testing.T) {
+	runner := NewExecRunner(Config{FFprobePath: script(t, `echo "out $1"; echo "progress" >&2`)})
+	stdout := bytes.Buffer{}
+
+	stderr, err := runner.Run(context.Background(), Job{Tool: FFprobe, Args: []string{"arg"}, Stdout: &stdout})
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if stdout.String() != "out arg\n" {
+		t.Errorf("stdout = %q; want %q", stdout.String(), "out arg\n")
+	}
+	if string(stderr) != "progress\n" {
+		t.Errorf("stderr = %q; want %q", stderr, "progress\n")
+	}
+}
+
+func TestExecRunnerFailure(t *testing.T) {
+	runner := NewExecRunner(Config{FFmpegPath: script(t, `echo "Invalid data found when processing input" >&2; exit 1`)})
+
+	_, err := runner.Run(context.Background(), Job{Tool: FFmpeg})
+	var mediaErr *Error
+	if !errors.As(err, &mediaErr) {
+		t.Fatalf("Run() error = %v; want *Error", err)
+	}
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) {
+		t.Errorf("Run() error = %v; want to wrap *exec.ExitError", err)
+	}
+	expected := "ffmpeg: exit status 1: Invalid data found when processing input"
+	if err.Error() != expected {
+		t.Errorf("Error() = %q; want %q", err.Error(), expected)
+	}
+}
+
+func TestExecRunnerTruncatesStderr(t *testing.T) {
+	runner := NewExecRunner(Config{FFmpegPath: script(t, `i=0; while [ $i -lt 500 ]; do echo "line $i" >&2; i=$((i+1)); done; exit 1`)})
+
+	_, err := runner.Run(context.Background(), Job{Tool: FFmpeg})
+	var mediaErr *Error
+	if !errors.As(err, &mediaErr) {
+		t.Fatalf("Run() error = %v; want *Error", err)
+	}
+	if len(mediaErr.Stderr) > maxErrorStderr+len("...") {
+		t.Errorf("Stderr is %d bytes; want at most %d", len(mediaErr.Stderr), maxErrorStderr+len("..."))
+	}
+	if !strings.HasPrefix(mediaErr.Stderr, "...") || !strings.HasSuffix(mediaErr.Stderr, "line 499") {
+		t.Errorf("Stderr = %q; want the end of the output", mediaErr.Stderr)
+	}
+}
+
+func TestExecRunnerTimeout(t *testing.T) {
+	runner := NewExecRunner(Config{FFmpegPath: script(t, `exec sleep 10`), Timeout: time.Hour})
+
+	start := time.Now()
+	_, err := runner.Run(context.Background(), Job{Tool: FFmpeg, Timeout: 50 * time.Millisecond})
+	if !errors.Is(err, ErrTimeout) {
+		t.Errorf("Run() error = %v; want ErrTimeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Run() took %s; want it stopped at the timeout", elapsed)
+	}
+}
+
+func TestExecRunnerCancel(t *testing.T) {
+	runner := NewExecRunner(Config{FFmpegPath: script(t, `exec sleep 10`)})
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	_, err := runner.Run(ctx, Job{Tool: FFmpeg})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Run() error = %v; want context.Canceled", err)
+	}
+}
+
+func TestExecRunnerConcurrencyLimit(t *testing.T) {
+	dir := t.TempDir()
+	// Each job records itself as running, fails if another job is, and
+	// then clears up
+	tool := script(t, `
+if [ -e "`+dir+`/running" ]; then exit 3; fi
+touch "`+dir+`/running"
+sleep 0.05
+rm "`+dir+`/running"`)
+	runner := NewExecRunner(Config{FFmpegPath: tool, MaxConcurrent: 1})
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 4)
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := runner.Run(context.Background(), Job{Tool: FFmpeg})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			t.Errorf("Run() error = %v; want jobs to run one at a time", err)
+		}
+	}
+}
+
+func TestExecRunnerWaitingForSlotCanBeCancelled(t *testing.T) {
+	runner := NewExecRunner(Config{FFmpegPath: script(t, `exec sleep 10`), MaxConcurrent: 1})
+	busyCtx, stopBusy := context.WithCancel(context.Background())
+	defer stopBusy()
+	go runner.Run(busyCtx, Job{Tool: FFmpeg})
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := runner.Run(ctx, Job{Tool: FFmpeg})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Run() error = %v; want context.DeadlineExceeded", err)
+	}
+}
+
+func TestExecRunnerProgress(t *testing.T) {
+	runner := NewExecRunner(Config{FFmpegPath: script(t, `echo "$*" >&2
+printf 'out_time_us=2000000\nspeed=1x\nprogress=continue\n'
+printf 'out_time_us=4000000\nspeed=1x\nprogress=end\n'`)})
+	var updates []Progress
+
+	stderr, err := runner.Run(context.Background(), Job{
+		Tool:     FFmpeg,
+		Args:     []string{"-i", "in.mp4", "out.mp4"},
+		Duration: 4,
+		Progress: func(p Progress) { updates = append(updates, p) },
+	})
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if string(stderr) != "-progress pipe:1 -nostats -i in.mp4 out.mp4\n" {
+		t.Errorf("args = %q; want -progress before the job's own", stderr)
+	}
+	if len(updates) != 2 || *updates[0].Percent != 50 || !updates[1].Done {
+		t.Errorf("updates = %+v; want 50%% then done", updates)
+	}
+}
+
+func TestExecRunnerProgressNeedsFFmpegWithoutStdout(t *testing.T) {
+	runner := NewExecRunner(Config{})
+	report := func(Progress) {}
+
+	_, err := runner.Run(context.Background(), Job{Tool: FFprobe, Progress: report})
+	if err == nil {
+		t.Errorf("Run(ffprobe) with Progress succeeded; want an error")
+	}
+	_, err = runner.Run(context.Background(), Job{Tool: FFmpeg, Stdout: &bytes.Buffer{}, Progress: report})
+	if err == nil {
+		t.Errorf("Run() with Stdout and Progress succeeded; want an error")
+	}
+}
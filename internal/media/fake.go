@@ -0,0 +1,54 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"sync"
+)
+
+// FakeRunner is a Runner for tests that records jobs instead of running
+// them.
+type FakeRunner struct {
+	// Called for each job in place of running it; its stdout is written to
+	// the job's Stdout, or parsed as -progress output for jobs that report
+	// progress. If nil, every job succeeds without output.
+	Handle func(job Job) (stdout, stderr []byte, err error)
+
+	mu   sync.Mutex
+	jobs []Job
+}
+
+func (f *FakeRunner) Run(ctx context.Context, job Job) ([]byte, error) {
+	f.mu.Lock()
+	f.jobs = append(f.jobs, job)
+	f.mu.Unlock()
+
+	if err := ctx.Err(); err != nil {
+		return nil, newError(job.Tool, err, nil)
+	}
+	if err := checkProgress(job); err != nil {
+		return nil, newError(job.Tool, err, nil)
+	}
+	if f.Handle == nil {
+		return nil, nil
+	}
+	stdout, stderr, err := f.Handle(job)
+	if job.Progress != nil {
+		ParseProgress(bytes.NewReader(stdout), job.Duration, job.Progress)
+	} else if job.Stdout != nil && len(stdout) > 0 {
+		if _, writeErr := job.Stdout.Write(stdout); writeErr != nil && err == nil {
+			err = writeErr
+		}
+	}
+	if err != nil {
+		return stderr, newError(job.Tool, err, stderr)
+	}
+	return stderr, nil
+}
+
+// Jobs returns the jobs run so far, in order.
+func (f *FakeRunner) Jobs() []Job {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]Job{}, f.jobs...)
+}
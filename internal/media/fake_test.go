@@ -0,0 +1,75 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestFakeRunner(t *testing.T) {
+	fake := &FakeRunner{
+		Handle: func(job Job) ([]byte, []byte, error) {
+			if job.Tool == FFprobe {
+				return []byte(`{"streams":[]}`), nil, nil
+			}
+			return nil, []byte("No such file"), errors.New("exit status 1")
+		},
+	}
+
+	stdout := bytes.Buffer{}
+	_, err := fake.Run(context.Background(), Job{Tool: FFprobe, Args: []string{"in.mp4"}, Stdout: &stdout})
+	if err != nil || stdout.String() != `{"streams":[]}` {
+		t.Errorf("Run(ffprobe) = %q, %v; want the handler's output", stdout.String(), err)
+	}
+
+	_, err = fake.Run(context.Background(), Job{Tool: FFmpeg, Args: []string{"-i", "in.mp4"}})
+	if err == nil || err.Error() != "ffmpeg: exit status 1: No such file" {
+		t.Errorf("Run(ffmpeg) error = %v; want the handler's error", err)
+	}
+
+	var tools [][]string
+	for _, job := range fake.Jobs() {
+		tools = append(tools, append([]string{string(job.Tool)}, job.Args...))
+	}
+	expected := [][]string{{"ffprobe", "in.mp4"}, {"ffmpeg", "-i", "in.mp4"}}
+	if !reflect.DeepEqual(tools, expected) {
+		t.Errorf("Jobs() = %v; want %v", tools, expected)
+	}
+}
+
+func TestFakeRunnerDefault(t *testing.T) {
+	fake := &FakeRunner{}
+	stderr, err := fake.Run(context.Background(), Job{Tool: FFmpeg})
+	if err != nil || stderr != nil {
+		t.Errorf("Run() = %q, %v; want success without output", stderr, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = fake.Run(ctx, Job{Tool: FFmpeg})
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("Run() with cancelled context error = %v; want context.Canceled", err)
+	}
+}
+
+func TestFakeRunnerProgress(t *testing.T) {
+	fake := &FakeRunner{
+		Handle: func(job Job) ([]byte, []byte, error) {
+			return []byte("out_time_us=3000000\nspeed=1.5x\nprogress=continue\n"), nil, nil
+		},
+	}
+	var updates []Progress
+	_, err := fake.Run(context.Background(), Job{
+		Tool:     FFmpeg,
+		Duration: 12,
+		Progress: func(p Progress) { updates = append(updates, p) },
+	})
+	if err != nil {
+		t.Fatalf("Run() error: %v", err)
+	}
+	if len(updates) != 1 || *updates[0].Percent != 25 || *updates[0].ETA != 6 {
+		t.Errorf("updates = %+v; want 25%% with 6s left", updates)
+	}
+}
@@ -0,0 +1,92 @@
+// Package media runs ffmpeg and ffprobe jobs with timeouts, cancellation, a
+// limit on how many run at once, and errors that say what went wrong.
+package media
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Tool is one of the programs a Runner can run.
+type Tool string
+
+const (
+	FFmpeg  Tool = "ffmpeg"
+	FFprobe Tool = "ffprobe"
+)
+
+// Job is a single run of a tool.
+type Job struct {
+	Tool Tool
+	Args []string
+	// Receives the tool's standard output if set; otherwise it's discarded
+	Stdout io.Writer
+	// Overrides the runner's default timeout if set
+	Timeout time.Duration
+	// Called as an ffmpeg job makes progress if set. Such jobs can't also
+	// set Stdout, as ffmpeg reports progress there.
+	Progress func(Progress)
+	// Seconds of media the job writes, used to estimate how far it's got;
+	// zero if unknown
+	Duration float64
+}
+
+// Runner runs jobs. Run returns what the tool wrote to standard error, which
+// is where ffmpeg reports filter output such as loudness measurements, along
+// with an *Error if the job didn't succeed.
+type Runner interface {
+	Run(ctx context.Context, job Job) ([]byte, error)
+}
+
+// Errors include at most this many bytes from the end of standard error,
+// where ffmpeg puts the reason it failed
+const maxErrorStderr = 2048
+
+// Error is a job that failed to run, exited unsuccessfully or was stopped.
+type Error struct {
+	Tool Tool
+	// The underlying failure, e.g. an *exec.ExitError or
+	// context.DeadlineExceeded
+	Err error
+	// The end of what the tool wrote to standard error
+	Stderr string
+}
+
+func (e *Error) Error() string {
+	if e.Stderr == "" {
+		return fmt.Sprintf("%s: %v", e.Tool, e.Err)
+	}
+	return fmt.Sprintf("%s: %v: %s", e.Tool, e.Err, e.Stderr)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ErrTimeout is wrapped by errors from jobs that ran out of time.
+var ErrTimeout = errors.New("timed out")
+
+func newError(tool Tool, err error, stderr []byte) *Error {
+	if len(stderr) > maxErrorStderr {
+		stderr = append([]byte("..."), stderr[len(stderr)-maxErrorStderr:]...)
+	}
+	return &Error{Tool: tool, Err: err, Stderr: strings.TrimSpace(string(stderr))}
+}
+
+// checkProgress rejects jobs that ask for progress they can't get.
+func checkProgress(job Job) error {
+	if job.Progress == nil {
+		return nil
+	}
+	if job.Tool != FFmpeg {
+		return errors.New("only ffmpeg reports progress")
+	}
+	if job.Stdout != nil {
+		return errors.New("a job can't report progress and write to Stdout")
+	}
+	return nil
+}
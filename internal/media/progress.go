@@ -0,0 +1,73 @@
+package media
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Progress is an update on how far an ffmpeg job has got.
+type Progress struct {
+	// Seconds of output written so far
+	Time float64
+	// Seconds of output written per second, e.g. 2 at twice real time; zero
+	// if ffmpeg hasn't worked it out yet
+	Speed float64
+	// How much of the job is done, from 0 to 100, if its duration is known
+	Percent *float64
+	// Estimated seconds until the job is done, if known
+	ETA *float64
+	// Set on the final update
+	Done bool
+}
+
+// ParseProgress reads the key=value blocks that ffmpeg writes with -progress
+// and calls report at the end of each. duration is the length in seconds of
+// the media being written, or zero if it isn't known, in which case updates
+// have no Percent or ETA.
+func ParseProgress(r io.Reader, duration float64, report func(Progress)) error {
+	scanner := bufio.NewScanner(r)
+	current := Progress{}
+	for scanner.Scan() {
+		key, value, ok := strings.Cut(strings.TrimSpace(scanner.Text()), "=")
+		if !ok {
+			continue
+		}
+		switch key {
+		// out_time_ms is in microseconds too, despite its name
+		case "out_time_us", "out_time_ms":
+			if us, err := strconv.ParseInt(value, 10, 64); err == nil && us >= 0 {
+				current.Time = float64(us) / float64(time.Second/time.Microsecond)
+			}
+		case "speed":
+			if speed, err := strconv.ParseFloat(strings.TrimSuffix(value, "x"), 64); err == nil {
+				current.Speed = speed
+			}
+		case "progress":
+			current.Done = value == "end"
+			report(withEstimates(current, duration))
+		}
+	}
+	return scanner.Err()
+}
+
+func withEstimates(p Progress, duration float64) Progress {
+	if duration <= 0 {
+		return p
+	}
+	percent := 100.0
+	eta := 0.0
+	if !p.Done {
+		percent = min(100, 100*p.Time/duration)
+		if p.Speed <= 0 {
+			p.Percent = &percent
+			return p
+		}
+		eta = max(0, duration-p.Time) / p.Speed
+	}
+	p.Percent = &percent
+	p.ETA = &eta
+	return p
+}
@@ -0,0 +1,70 @@
+package media
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const progressOutput = `frame=24
+fps=0.00
+out_time_us=1000000
+out_time_ms=1000000
+out_time=00:00:01.000000
+speed=N/A
+progress=continue
+frame=240
+out_time_us=5000000
+out_time_ms=5000000
+out_time=00:00:05.000000
+speed=2.5x
+progress=continue
+frame=480
+out_time_us=N/A
+out_time_ms=N/A
+out_time=N/A
+speed=2.51x
+progress=end
+`
+
+func ptr(f float64) *float64 {
+	return &f
+}
+
+func TestParseProgress(t *testing.T) {
+	var updates []Progress
+	err := ParseProgress(strings.NewReader(progressOutput), 10, func(p Progress) {
+		updates = append(updates, p)
+	})
+	if err != nil {
+		t.Fatalf("ParseProgress() error: %v", err)
+	}
+
+	expected := []Progress{
+		{Time: 1, Percent: ptr(10)},
+		{Time: 5, Speed: 2.5, Percent: ptr(50), ETA: ptr(2)},
+		{Time: 5, Speed: 2.51, Percent: ptr(100), ETA: ptr(0), Done: true},
+	}
+	if !reflect.DeepEqual(updates, expected) {
+		t.Errorf("updates = %+v; want %+v", updates, expected)
+	}
+}
+
+func TestParseProgressUnknownDuration(t *testing.T) {
+	var updates []Progress
+	ParseProgress(strings.NewReader(progressOutput), 0, func(p Progress) {
+		updates = append(updates, p)
+	})
+
+	if len(updates) != 3 {
+		t.Fatalf("got %d updates; want 3", len(updates))
+	}
+	for i, p := range updates {
+		if p.Percent != nil || p.ETA != nil {
+			t.Errorf("update %d has estimates; want none without a duration", i)
+		}
+	}
+	if !updates[2].Done {
+		t.Errorf("last update isn't Done")
+	}
+}
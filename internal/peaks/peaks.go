@@ -0,0 +1,120 @@
+// Package peaks summarises audio as the minimum and maximum sample in each
+// of a number of buckets, at several resolutions, so that waveforms can be
+// drawn without decoding the media.
+package peaks
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Format version of Peaks, bumped if the layout changes
+const Version = 1
+
+// Resolutions are the approximate bucket counts generated for each piece of
+// media, coarsest first.
+var Resolutions = []int{256, 1024, 4096}
+
+// Peaks is the summary stored for a piece of media.
+type Peaks struct {
+	Version    int `json:"version"`
+	SampleRate int `json:"sample_rate"`
+	// Levels from coarsest to finest
+	Levels []Level `json:"levels"`
+}
+
+// Level is the summary at one resolution.
+type Level struct {
+	SamplesPerBucket int `json:"samples_per_bucket"`
+	Length           int `json:"length"`
+	// Min then max sample of each bucket in turn, as signed 16-bit values
+	Data []int16 `json:"data"`
+}
+
+// SamplesPerBucket works out how many samples to put in each bucket to get
+// roughly the given number of buckets from media of the given duration.
+func SamplesPerBucket(duration float64, sampleRate, buckets int) int {
+	total := duration * float64(sampleRate)
+	return max(1, int(math.Ceil(total/float64(buckets))))
+}
+
+// Builder is an io.Writer that accumulates Peaks from signed 16-bit
+// little-endian mono PCM.
+type Builder struct {
+	sampleRate int
+	levels     []levelBuilder
+	// Odd byte left over from the last write
+	pending []byte
+}
+
+type levelBuilder struct {
+	samplesPerBucket int
+	count            int
+	min, max         int16
+	data             []int16
+}
+
+// NewBuilder returns a Builder for each of the given bucket sizes.
+func NewBuilder(sampleRate int, samplesPerBucket ...int) *Builder {
+	b := &Builder{sampleRate: sampleRate}
+	for _, size := range samplesPerBucket {
+		b.levels = append(b.levels, levelBuilder{samplesPerBucket: size, data: []int16{}})
+	}
+	return b
+}
+
+func (b *Builder) Write(p []byte) (int, error) {
+	n := len(p)
+	if len(b.pending) > 0 {
+		p = append(b.pending, p...)
+		b.pending = nil
+	}
+	for len(p) >= 2 {
+		sample := int16(binary.LittleEndian.Uint16(p))
+		for i := range b.levels {
+			b.levels[i].add(sample)
+		}
+		p = p[2:]
+	}
+	if len(p) > 0 {
+		b.pending = append([]byte{}, p...)
+	}
+	return n, nil
+}
+
+func (l *levelBuilder) add(sample int16) {
+	if l.count == 0 {
+		l.min, l.max = sample, sample
+	} else {
+		l.min = min(l.min, sample)
+		l.max = max(l.max, sample)
+	}
+	l.count++
+	if l.count == l.samplesPerBucket {
+		l.flush()
+	}
+}
+
+func (l *levelBuilder) flush() {
+	if l.count == 0 {
+		return
+	}
+	l.data = append(l.data, l.min, l.max)
+	l.count = 0
+}
+
+// Peaks returns everything written so far, with any partly filled final
+// bucket included. It should be called once writing is finished.
+func (b *Builder) Peaks() Peaks {
+	p := Peaks{Version: Version, SampleRate: b.sampleRate, Levels: []Level{}}
+	for i := range b.levels {
+		l := &b.levels[i]
+		l.flush()
+		p.Levels = append(p.Levels, Level{
+			SamplesPerBucket: l.samplesPerBucket,
+			Length:           len(l.data) / 2,
+			Data:             l.data,
+		})
+	}
+	return p
+}
@@ -0,0 +1,78 @@
+package peaks
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+)
+
+func pcm(samples ...int16) []byte {
+	data := make([]byte, 2*len(samples))
+	for i, sample := range samples {
+		binary.LittleEndian.PutUint16(data[2*i:], uint16(sample))
+	}
+	return data
+}
+
+func TestBuilder(t *testing.T) {
+	b := NewBuilder(8000, 2, 4)
+	b.Write(pcm(1, -3, 5, 2, -32768, 32767, 7))
+	p := b.Peaks()
+
+	expected := Peaks{
+		Version:    Version,
+		SampleRate: 8000,
+		Levels: []Level{
+			{SamplesPerBucket: 2, Length: 4, Data: []int16{-3, 1, 2, 5, -32768, 32767, 7, 7}},
+			{SamplesPerBucket: 4, Length: 2, Data: []int16{-3, 5, -32768, 32767}},
+		},
+	}
+	if !reflect.DeepEqual(p, expected) {
+		t.Errorf("Peaks() = %+v; want %+v", p, expected)
+	}
+}
+
+func TestBuilderSplitWrites(t *testing.T) {
+	data := pcm(100, -200, 300, -400)
+	b := NewBuilder(8000, 4)
+	// Split in the middle of a sample
+	for _, chunk := range [][]byte{data[:3], data[3:5], data[5:]} {
+		n, err := b.Write(chunk)
+		if err != nil || n != len(chunk) {
+			t.Fatalf("Write() = %d, %v; want %d, nil", n, err, len(chunk))
+		}
+	}
+
+	expected := []int16{-400, 300}
+	if result := b.Peaks().Levels[0].Data; !reflect.DeepEqual(result, expected) {
+		t.Errorf("Data = %v; want %v", result, expected)
+	}
+}
+
+func TestBuilderEmpty(t *testing.T) {
+	p := NewBuilder(8000, 10).Peaks()
+	if p.Levels[0].Length != 0 || len(p.Levels[0].Data) != 0 {
+		t.Errorf("empty level = %+v; want no buckets", p.Levels[0])
+	}
+}
+
+func TestSamplesPerBucket(t *testing.T) {
+	tests := []struct {
+		duration   float64
+		sampleRate int
+		buckets    int
+		expected   int
+	}{
+		{60, 8000, 1000, 480},
+		{60.1, 8000, 1000, 481},
+		{0.01, 8000, 4096, 1},
+		{0, 8000, 256, 1},
+	}
+
+	for _, tt := range tests {
+		result := SamplesPerBucket(tt.duration, tt.sampleRate, tt.buckets)
+		if result != tt.expected {
+			t.Errorf("SamplesPerBucket(%v, %d, %d) = %d; want %d", tt.duration, tt.sampleRate, tt.buckets, result, tt.expected)
+		}
+	}
+}
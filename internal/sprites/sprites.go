@@ -0,0 +1,87 @@
+// Package sprites lays out sprite sheets of video frames for scrubbing
+// previews and describes them with a WebVTT thumbnails track.
+package sprites
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/venzy/learn-file-storage-s3-golang/internal/captions"
+)
+
+const (
+	// Frames are taken at least this many seconds apart, and further apart
+	// for long videos so the sheet doesn't exceed maxFrames
+	minInterval = 5.0
+	maxFrames   = 100
+	maxColumns  = 10
+	tileWidth   = 160
+	// Used when the video's dimensions aren't known
+	defaultTileHeight = 90
+)
+
+// Sheet is the layout of a single sprite sheet image.
+type Sheet struct {
+	// Seconds between frames
+	Interval   float64
+	FrameCount int
+	Columns    int
+	Rows       int
+	TileWidth  int
+	TileHeight int
+}
+
+// NewSheet lays out a sheet for a video of the given duration (in seconds)
+// and dimensions.
+func NewSheet(duration float64, width, height int) Sheet {
+	interval := max(minInterval, duration/maxFrames)
+	frameCount := max(1, min(maxFrames, int(math.Ceil(duration/interval))))
+	columns := min(maxColumns, frameCount)
+
+	tileHeight := defaultTileHeight
+	if width > 0 && height > 0 {
+		// Round to an even number, as most encoders require
+		tileHeight = 2 * int(math.Round(float64(tileWidth*height)/float64(width)/2))
+	}
+
+	return Sheet{
+		Interval:   interval,
+		FrameCount: frameCount,
+		Columns:    columns,
+		Rows:       (frameCount + columns - 1) / columns,
+		TileWidth:  tileWidth,
+		TileHeight: tileHeight,
+	}
+}
+
+// FFmpegFilter is the video filter that renders the sheet as a single frame.
+func (s Sheet) FFmpegFilter() string {
+	return fmt.Sprintf("fps=1/%g,scale=%d:%d,tile=%dx%d", s.Interval, s.TileWidth, s.TileHeight, s.Columns, s.Rows)
+}
+
+// WebVTT maps each frame's time range to its region of the sheet image at
+// spriteURL using media fragments, as players' thumbnail tracks expect.
+func (s Sheet) WebVTT(spriteURL string, duration float64) []byte {
+	var b strings.Builder
+	b.WriteString("WEBVTT\n")
+	for i := 0; i < s.FrameCount; i++ {
+		start := float64(i) * s.Interval
+		end := min(start+s.Interval, duration)
+		if end <= start {
+			break
+		}
+		x := (i % s.Columns) * s.TileWidth
+		y := (i / s.Columns) * s.TileHeight
+		fmt.Fprintf(&b, "\n%s --> %s\n%s#xywh=%d,%d,%d,%d\n",
+			captions.FormatTimestamp(seconds(start)),
+			captions.FormatTimestamp(seconds(end)),
+			spriteURL, x, y, s.TileWidth, s.TileHeight)
+	}
+	return []byte(b.String())
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(math.Round(s * float64(time.Second)))
+}
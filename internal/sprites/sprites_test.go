@@ -0,0 +1,46 @@
+package sprites
+
+import "testing"
+
+func TestNewSheet(t *testing.T) {
+	tests := []struct {
+		name     string
+		duration float64
+		width    int
+		height   int
+		expected Sheet
+	}{
+		{"short landscape", 12, 1920, 1080, Sheet{Interval: 5, FrameCount: 3, Columns: 3, Rows: 1, TileWidth: 160, TileHeight: 90}},
+		{"portrait", 60, 1080, 1920, Sheet{Interval: 5, FrameCount: 12, Columns: 10, Rows: 2, TileWidth: 160, TileHeight: 284}},
+		{"long", 1000, 640, 480, Sheet{Interval: 10, FrameCount: 100, Columns: 10, Rows: 10, TileWidth: 160, TileHeight: 120}},
+		{"unknown size", 1, 0, 0, Sheet{Interval: 5, FrameCount: 1, Columns: 1, Rows: 1, TileWidth: 160, TileHeight: 90}},
+	}
+
+	for _, tt := range tests {
+		result := NewSheet(tt.duration, tt.width, tt.height)
+		if result != tt.expected {
+			t.Errorf("NewSheet(%s) = %+v; want %+v", tt.name, result, tt.expected)
+		}
+	}
+}
+
+func TestFFmpegFilter(t *testing.T) {
+	sheet := NewSheet(12, 1920, 1080)
+	expected := "fps=1/5,scale=160:90,tile=3x1"
+	if result := sheet.FFmpegFilter(); result != expected {
+		t.Errorf("FFmpegFilter() = %q; want %q", result, expected)
+	}
+}
+
+func TestWebVTT(t *testing.T) {
+	sheet := Sheet{Interval: 5, FrameCount: 3, Columns: 2, Rows: 2, TileWidth: 160, TileHeight: 90}
+	expected := "WEBVTT\n" +
+		"\n00:00:00.000 --> 00:00:05.000\nhttps://cdn/s.jpg#xywh=0,0,160,90\n" +
+		"\n00:00:05.000 --> 00:00:10.000\nhttps://cdn/s.jpg#xywh=160,0,160,90\n" +
+		"\n00:00:10.000 --> 00:00:12.500\nhttps://cdn/s.jpg#xywh=0,90,160,90\n"
+
+	result := string(sheet.WebVTT("https://cdn/s.jpg", 12.5))
+	if result != expected {
+		t.Errorf("WebVTT() = %q; want %q", result, expected)
+	}
+}
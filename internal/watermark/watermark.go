@@ -0,0 +1,90 @@
+// Package watermark builds the ffmpeg filters that overlay a watermark image
+// on a video.
+package watermark
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+type Position string
+
+const (
+	TopLeft     Position = "top-left"
+	TopRight    Position = "top-right"
+	BottomLeft  Position = "bottom-left"
+	BottomRight Position = "bottom-right"
+	Center      Position = "center"
+)
+
+func (p Position) Valid() bool {
+	switch p {
+	case TopLeft, TopRight, BottomLeft, BottomRight, Center:
+		return true
+	default:
+		return false
+	}
+}
+
+// Gap in pixels between the watermark and the edges of the video
+const margin = 16
+
+// Config says where and how a watermark is drawn.
+type Config struct {
+	Position Position
+	// 0 (invisible) to 1 (opaque)
+	Opacity float64
+	// Width of the watermark as a fraction of the video's width
+	Scale float64
+}
+
+// Default is used for anything not configured.
+var Default = Config{
+	Position: BottomRight,
+	Opacity:  0.5,
+	Scale:    0.15,
+}
+
+func (c Config) Validate() error {
+	if !c.Position.Valid() {
+		return fmt.Errorf("position must be one of %s, %s, %s, %s or %s", TopLeft, TopRight, BottomLeft, BottomRight, Center)
+	}
+	if c.Opacity <= 0 || c.Opacity > 1 {
+		return errors.New("opacity must be greater than 0 and at most 1")
+	}
+	if c.Scale <= 0 || c.Scale > 1 {
+		return errors.New("scale must be greater than 0 and at most 1")
+	}
+	return nil
+}
+
+// FilterComplex is an ffmpeg -filter_complex graph that overlays input 1 (the
+// watermark) on input 0 (the video), labelling the result [out]. The
+// watermark is scaled to a share of the video's width and keeps its own
+// aspect ratio.
+func (c Config) FilterComplex() string {
+	return "[1:v][0:v]scale2ref=w=main_w*" + formatFloat(c.Scale) + ":h=ow/a[wm][base];" +
+		"[wm]format=rgba,colorchannelmixer=aa=" + formatFloat(c.Opacity) + "[faded];" +
+		"[base][faded]overlay=" + c.overlayPosition() + ":format=auto[out]"
+}
+
+func (c Config) overlayPosition() string {
+	m := strconv.Itoa(margin)
+	switch c.Position {
+	case TopLeft:
+		return m + ":" + m
+	case TopRight:
+		return "main_w-overlay_w-" + m + ":" + m
+	case BottomLeft:
+		return m + ":main_h-overlay_h-" + m
+	case Center:
+		return "(main_w-overlay_w)/2:(main_h-overlay_h)/2"
+	default:
+		return "main_w-overlay_w-" + m + ":main_h-overlay_h-" + m
+	}
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
@@ -0,0 +1,109 @@
+package watermark
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		config  Config
+		wantErr bool
+	}{
+		{Default, false},
+		{Config{Position: Center, Opacity: 1, Scale: 1}, false},
+		{Config{Position: "middle", Opacity: 0.5, Scale: 0.1}, true},
+		{Config{Position: TopLeft, Opacity: 0, Scale: 0.1}, true},
+		{Config{Position: TopLeft, Opacity: 1.5, Scale: 0.1}, true},
+		{Config{Position: TopLeft, Opacity: 0.5, Scale: 0}, true},
+		{Config{Position: TopLeft, Opacity: 0.5, Scale: 2}, true},
+	}
+
+	for _, tt := range tests {
+		err := tt.config.Validate()
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%+v.Validate() = %v; want error %v", tt.config, err, tt.wantErr)
+		}
+	}
+}
+
+func TestFilterComplex(t *testing.T) {
+	config := Config{Position: TopRight, Opacity: 0.25, Scale: 0.2}
+	expected := "[1:v][0:v]scale2ref=w=main_w*0.2:h=ow/a[wm][base];" +
+		"[wm]format=rgba,colorchannelmixer=aa=0.25[faded];" +
+		"[base][faded]overlay=main_w-overlay_w-16:16:format=auto[out]"
+
+	if result := config.FilterComplex(); result != expected {
+		t.Errorf("FilterComplex() = %q; want %q", result, expected)
+	}
+}
+
+func TestFilterComplexKeepsWatermarkShape(t *testing.T) {
+	// A square watermark on a 16:9 video should stay square
+	const videoW, videoH, markW, markH = 1920.0, 1080.0, 200.0, 200.0
+	vars := map[string]float64{
+		"main_w": videoW, "main_h": videoH, "mdar": videoW / videoH,
+		"iw": markW, "ih": markH, "a": markW / markH, "dar": markW / markH,
+	}
+
+	graph := Config{Position: BottomRight, Opacity: 0.5, Scale: 0.25}.FilterComplex()
+	_, rest, ok := strings.Cut(graph, "scale2ref=")
+	if !ok {
+		t.Fatalf("FilterComplex() = %q; want a scale2ref filter", graph)
+	}
+	options, _, _ := strings.Cut(rest, "[")
+	sizes := map[string]float64{}
+	for _, option := range strings.Split(options, ":") {
+		key, expr, _ := strings.Cut(option, "=")
+		vars["ow"] = sizes["w"]
+		sizes[key] = evaluate(t, expr, vars)
+	}
+
+	if sizes["w"] != 480 || sizes["h"] != 480 {
+		t.Errorf("watermark scaled to %gx%g; want 480x480", sizes["w"], sizes["h"])
+	}
+}
+
+// evaluate works out a scale2ref size expression of the form "a", "a*b" or
+// "a/b", where each operand is a number or a variable.
+func evaluate(t *testing.T, expr string, vars map[string]float64) float64 {
+	t.Helper()
+	operand := func(s string) float64 {
+		if v, ok := vars[s]; ok {
+			return v
+		}
+		f, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			t.Fatalf("can't evaluate %q in %q", s, expr)
+		}
+		return f
+	}
+	if a, b, ok := strings.Cut(expr, "*"); ok {
+		return operand(a) * operand(b)
+	}
+	if a, b, ok := strings.Cut(expr, "/"); ok {
+		return operand(a) / operand(b)
+	}
+	return operand(expr)
+}
+
+func TestOverlayPosition(t *testing.T) {
+	tests := []struct {
+		position Position
+		expected string
+	}{
+		{TopLeft, "16:16"},
+		{TopRight, "main_w-overlay_w-16:16"},
+		{BottomLeft, "16:main_h-overlay_h-16"},
+		{BottomRight, "main_w-overlay_w-16:main_h-overlay_h-16"},
+		{Center, "(main_w-overlay_w)/2:(main_h-overlay_h)/2"},
+	}
+
+	for _, tt := range tests {
+		result := Config{Position: tt.position}.overlayPosition()
+		if result != tt.expected {
+			t.Errorf("overlayPosition(%s) = %q; want %q", tt.position, result, tt.expected)
+		}
+	}
+}
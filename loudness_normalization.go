@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/venzy/learn-file-storage-s3-golang/internal/loudness"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/media"
+)
+
+// normalizeLoudness brings each audio track of a processed file to target
+// using loudnorm's two-pass mode: the first pass measures a track, and the
+// second applies a gain based on the measurement. The video is copied as it
+// is. It returns the normalised file's path and the measurement of the
+// default audio track, or an empty path if there was no audio to normalise.
+func (cfg *apiConfig) normalizeLoudness(ctx context.Context, filePath string, target loudness.Target, duration float64, job *processingJob) (string, *loudness.Measurement, error) {
+	streams, err := cfg.probeStreams(ctx, filePath)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Silent tracks are left as they are
+	job.startStage(stageMeasuringLoudness)
+	var measurements []*loudness.Measurement
+	var defaultMeasurement *loudness.Measurement
+	normalizing := false
+	for _, stream := range streams {
+		if stream.CodecType != "audio" {
+			continue
+		}
+		measurement, err := cfg.measureLoudness(ctx, filePath, len(measurements), target, duration, job.report)
+		if errors.Is(err, loudness.ErrSilent) {
+			measurements = append(measurements, nil)
+			continue
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		measurements = append(measurements, &measurement)
+		normalizing = true
+		if defaultMeasurement == nil || stream.Disposition.Default == 1 {
+			defaultMeasurement = &measurement
+		}
+	}
+	if !normalizing {
+		return "", nil, nil
+	}
+
+	outputFilePath := filePath + ".normalized"
+	args := []string{"-v", "error", "-i", filePath, "-map", "0:v?", "-map", "0:a", "-c:v", "copy"}
+	for i, measurement := range measurements {
+		track := strconv.Itoa(i)
+		if measurement == nil {
+			args = append(args, "-c:a:"+track, "copy")
+			continue
+		}
+		// loudnorm works at 192kHz internally, so bring it back down
+		args = append(args,
+			"-filter:a:"+track, target.NormalizeFilter(*measurement),
+			"-c:a:"+track, "aac", "-b:a:"+track, "192k", "-ar:a:"+track, "48000")
+	}
+	args = append(args, "-movflags", "faststart", "-f", "mp4", "-y", outputFilePath)
+
+	job.startStage(stageNormalizingLoudness)
+	err = cfg.ffmpegWithProgress(ctx, job.report, duration, args...)
+	if err != nil {
+		return "", nil, err
+	}
+	return outputFilePath, defaultMeasurement, nil
+}
+
+// measureLoudness runs loudnorm's first pass over the nth audio track.
+func (cfg *apiConfig) measureLoudness(ctx context.Context, filePath string, track int, target loudness.Target, duration float64, report func(media.Progress)) (loudness.Measurement, error) {
+	// loudnorm prints its report to stderr
+	output, err := cfg.media.Run(ctx, media.Job{
+		Tool: media.FFmpeg,
+		Args: []string{"-hide_banner", "-nostats",
+			"-i", filePath,
+			"-map", fmt.Sprintf("0:a:%d", track),
+			"-af", target.MeasureFilter(),
+			"-f", "null", "-"},
+		Progress: report,
+		Duration: duration,
+	})
+	if err != nil {
+		return loudness.Measurement{}, err
+	}
+	return loudness.ParseMeasurement(output)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/venzy/learn-file-storage-s3-golang/internal/loudness"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/media"
+)
+
+func TestNormalizeLoudness(t *testing.T) {
+	streams := probeOutput(
+		`"index":0,"codec_type":"video","codec_name":"h264"`,
+		`"index":1,"codec_type":"audio","codec_name":"aac","disposition":{"default":0}`,
+		`"index":2,"codec_type":"audio","codec_name":"aac","disposition":{"default":0}`,
+		`"index":3,"codec_type":"audio","codec_name":"aac","disposition":{"default":1}`,
+	)
+	// loudnorm's first-pass report for each audio track; the second is silent
+	reports := map[string]string{
+		"0:a:0": `{"input_i":"-27.61","input_tp":"-4.47","input_lra":"18.06","input_thresh":"-39.20","target_offset":"0.58"}`,
+		"0:a:1": `{"input_i":"-inf","input_tp":"-inf","input_lra":"0.00","input_thresh":"-70.00","target_offset":"0.00"}`,
+		"0:a:2": `{"input_i":"-16.20","input_tp":"-0.50","input_lra":"6.10","input_thresh":"-26.40","target_offset":"-0.30"}`,
+	}
+	cfg, runner := fakeMediaConfig(func(job media.Job) ([]byte, []byte, error) {
+		if job.Tool == media.FFprobe {
+			return streams, nil, nil
+		}
+		if report, ok := reports[argAfter(job.Args, "-map")]; ok {
+			return nil, []byte("[Parsed_loudnorm_0 @ 0x1]\n" + report + "\n"), nil
+		}
+		return nil, nil, nil
+	})
+
+	output, measurement, err := cfg.normalizeLoudness(context.Background(), "video.mp4", loudness.Default, 60, nil)
+	if err != nil {
+		t.Fatalf("normalizeLoudness() error: %v", err)
+	}
+	if output != "video.mp4.normalized" {
+		t.Errorf("output = %q; want %q", output, "video.mp4.normalized")
+	}
+	// The measurement recorded is that of the default track
+	if measurement == nil || measurement.Integrated != -16.2 {
+		t.Errorf("measurement = %+v; want the default track's", measurement)
+	}
+
+	jobs := runner.Jobs()
+	if len(jobs) != 5 {
+		t.Fatalf("ran %d jobs; want a probe, three measurements and a normalisation", len(jobs))
+	}
+	args := jobs[4].Args
+	first, _ := loudness.ParseMeasurement([]byte(reports["0:a:0"]))
+	third, _ := loudness.ParseMeasurement([]byte(reports["0:a:2"]))
+	if !hasArgs(args, "-filter:a:0", loudness.Default.NormalizeFilter(first)) {
+		t.Errorf("args %q don't normalise track 0 with its measurement", args)
+	}
+	if !hasArgs(args, "-c:a:1", "copy") || hasArgs(args, "-filter:a:1") {
+		t.Errorf("args %q don't copy the silent track 1", args)
+	}
+	if !hasArgs(args, "-filter:a:2", loudness.Default.NormalizeFilter(third)) {
+		t.Errorf("args %q don't normalise track 2 with its measurement", args)
+	}
+	if !hasArgs(args, "-c:v", "copy") {
+		t.Errorf("args %q don't copy the video", args)
+	}
+}
+
+func TestNormalizeLoudnessAllSilent(t *testing.T) {
+	cfg, runner := fakeMediaConfig(func(job media.Job) ([]byte, []byte, error) {
+		if job.Tool == media.FFprobe {
+			return probeOutput(`"index":0,"codec_type":"audio","codec_name":"aac"`), nil, nil
+		}
+		return nil, []byte(`{"input_i":"-inf","input_tp":"-inf","input_lra":"0.00","input_thresh":"-70.00","target_offset":"0.00"}`), nil
+	})
+
+	output, measurement, err := cfg.normalizeLoudness(context.Background(), "video.mp4", loudness.Default, 60, nil)
+	if err != nil || output != "" || measurement != nil {
+		t.Errorf("normalizeLoudness() = %q, %v, %v; want nothing to do", output, measurement, err)
+	}
+	if len(runner.Jobs()) != 2 {
+		t.Errorf("ran %d jobs; want only a probe and a measurement", len(runner.Jobs()))
+	}
+}
@@ -5,10 +5,13 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/venzy/learn-file-storage-s3-golang/internal/database"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/media"
 
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
@@ -25,6 +28,11 @@ type apiConfig struct {
 	s3Region         string
 	s3CfDistribution string
 	port             string
+	clock            clock
+	// Zero if preview clips are disabled
+	previewClipLength float64
+	// Runs ffmpeg and ffprobe
+	media media.Runner
 }
 
 func main() {
@@ -40,6 +48,12 @@ func main() {
 		log.Fatalf("Couldn't connect to database: %v", err)
 	}
 
+	// Processing that was under way when the server last stopped won't finish
+	err = db.FailInterruptedProcessingJobs()
+	if err != nil {
+		log.Fatalf("Couldn't clean up processing jobs: %v", err)
+	}
+
 	jwtSecret := os.Getenv("JWT_SECRET")
 	if jwtSecret == "" {
 		log.Fatal("JWT_SECRET environment variable is not set")
@@ -80,26 +94,54 @@ func main() {
 		log.Fatal("PORT environment variable is not set")
 	}
 
+	previewClipLength := 0.0
+	if previewClipLengthString := os.Getenv("PREVIEW_CLIP_LENGTH"); previewClipLengthString != "" {
+		previewClipLength, err = strconv.ParseFloat(previewClipLengthString, 64)
+		if err != nil || previewClipLength <= 0 {
+			log.Fatal("PREVIEW_CLIP_LENGTH must be a positive number of seconds")
+		}
+	}
+
+	mediaConfig := media.Config{
+		FFmpegPath:  os.Getenv("FFMPEG_PATH"),
+		FFprobePath: os.Getenv("FFPROBE_PATH"),
+	}
+	if timeoutString := os.Getenv("MEDIA_JOB_TIMEOUT"); timeoutString != "" {
+		mediaConfig.Timeout, err = time.ParseDuration(timeoutString)
+		if err != nil || mediaConfig.Timeout <= 0 {
+			log.Fatal("MEDIA_JOB_TIMEOUT must be a positive duration, e.g. 30m")
+		}
+	}
+	if maxConcurrentString := os.Getenv("MEDIA_MAX_CONCURRENT"); maxConcurrentString != "" {
+		mediaConfig.MaxConcurrent, err = strconv.Atoi(maxConcurrentString)
+		if err != nil || mediaConfig.MaxConcurrent <= 0 {
+			log.Fatal("MEDIA_MAX_CONCURRENT must be a positive number")
+		}
+	}
+
 	// Load AWS SDK config
 	awsConfig, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion(s3Region))
 	if err != nil {
-		log.Fatalf("Unable to load AWS SDK config, " + "please check your AWS credentials: %v", err)
+		log.Fatalf("Unable to load AWS SDK config, "+"please check your AWS credentials: %v", err)
 	}
 
 	// Create S3 client
 	s3Client := s3.NewFromConfig(awsConfig)
 
 	cfg := apiConfig{
-		db:               db,
-		jwtSecret:        jwtSecret,
-		platform:         platform,
-		filepathRoot:     filepathRoot,
-		assetsRoot:       assetsRoot,
-		s3Client: 	      s3Client,
-		s3Bucket:         s3Bucket,
-		s3Region:         s3Region,
-		s3CfDistribution: s3CfDistribution,
-		port:             port,
+		db:                db,
+		jwtSecret:         jwtSecret,
+		platform:          platform,
+		filepathRoot:      filepathRoot,
+		assetsRoot:        assetsRoot,
+		s3Client:          s3Client,
+		s3Bucket:          s3Bucket,
+		s3Region:          s3Region,
+		s3CfDistribution:  s3CfDistribution,
+		port:              port,
+		clock:             systemClock{},
+		previewClipLength: previewClipLength,
+		media:             media.NewExecRunner(mediaConfig),
 	}
 
 	err = cfg.ensureAssetsDir()
@@ -107,6 +149,19 @@ func main() {
 		log.Fatalf("Couldn't create assets directory: %v", err)
 	}
 
+	scheduler := &publishScheduler{
+		db:       db,
+		clock:    cfg.clock,
+		interval: 30 * time.Second,
+	}
+	go scheduler.Run(context.Background())
+
+	purger := &trashPurger{
+		cfg:      &cfg,
+		interval: time.Hour,
+	}
+	go purger.Run(context.Background())
+
 	mux := http.NewServeMux()
 	appHandler := http.StripPrefix("/app", http.FileServer(http.Dir(filepathRoot)))
 	mux.Handle("/app/", appHandler)
@@ -123,9 +178,66 @@ func main() {
 	mux.HandleFunc("POST /api/videos", cfg.handlerVideoMetaCreate)
 	mux.HandleFunc("POST /api/thumbnail_upload/{videoID}", cfg.handlerUploadThumbnail)
 	mux.HandleFunc("POST /api/video_upload/{videoID}", cfg.handlerUploadVideo)
+	mux.HandleFunc("POST /api/audio_upload/{videoID}", cfg.handlerUploadAudio)
 	mux.HandleFunc("GET /api/videos", cfg.handlerVideosRetrieve)
+	mux.HandleFunc("GET /api/videos/search", cfg.handlerVideosSearch)
 	mux.HandleFunc("GET /api/videos/{videoID}", cfg.handlerVideoGet)
+	mux.HandleFunc("PATCH /api/videos/{videoID}", cfg.handlerVideoMetaUpdate)
 	mux.HandleFunc("DELETE /api/videos/{videoID}", cfg.handlerVideoMetaDelete)
+	mux.HandleFunc("POST /api/videos/{videoID}/clips", cfg.handlerClipCreate)
+	mux.HandleFunc("GET /api/videos/{videoID}/original", cfg.handlerVideoOriginal)
+	mux.HandleFunc("GET /api/videos/{videoID}/processing", cfg.handlerProcessingGet)
+	mux.HandleFunc("GET /api/videos/{videoID}/processing/events", cfg.handlerProcessingEvents)
+	mux.HandleFunc("GET /api/videos/{videoID}/peaks", cfg.handlerVideoPeaks)
+	mux.HandleFunc("PUT /api/videos/{videoID}/chapters", cfg.handlerChaptersPut)
+	mux.HandleFunc("GET /api/videos/{videoID}/chapters.vtt", cfg.handlerChaptersWebVTT)
+	mux.HandleFunc("PUT /api/watermark", cfg.handlerWatermarkPut)
+	mux.HandleFunc("GET /api/watermark", cfg.handlerWatermarkGet)
+	mux.HandleFunc("DELETE /api/watermark", cfg.handlerWatermarkDelete)
+	mux.HandleFunc("PUT /api/videos/{videoID}/captions/{language}", cfg.handlerCaptionTrackPut)
+	mux.HandleFunc("DELETE /api/videos/{videoID}/captions/{language}", cfg.handlerCaptionTrackDelete)
+	mux.HandleFunc("GET /api/videos/{videoID}/versions", cfg.handlerVideoVersionsRetrieve)
+	mux.HandleFunc("POST /api/videos/{videoID}/versions/{versionID}/activate", cfg.handlerVideoVersionActivate)
+	mux.HandleFunc("GET /api/trash", cfg.handlerTrashRetrieve)
+	mux.HandleFunc("POST /api/videos/{videoID}/restore", cfg.handlerVideoRestore)
+
+	mux.HandleFunc("POST /api/videos/{videoID}/events", cfg.handlerPlaybackEvent)
+	mux.HandleFunc("GET /api/videos/{videoID}/stats", cfg.handlerVideoStats)
+
+	mux.HandleFunc("PUT /api/videos/{videoID}/progress", cfg.handlerWatchProgressPut)
+	mux.HandleFunc("GET /api/videos/{videoID}/progress", cfg.handlerWatchProgressGet)
+	mux.HandleFunc("GET /api/continue_watching", cfg.handlerContinueWatching)
+
+	mux.HandleFunc("GET /api/videos/{videoID}/comments", cfg.handlerCommentsRetrieve)
+	mux.HandleFunc("POST /api/videos/{videoID}/comments", cfg.handlerCommentCreate)
+	mux.HandleFunc("PATCH /api/comments/{commentID}", cfg.handlerCommentUpdate)
+	mux.HandleFunc("DELETE /api/comments/{commentID}", cfg.handlerCommentDelete)
+	mux.HandleFunc("GET /api/comments/{commentID}/replies", cfg.handlerCommentRepliesRetrieve)
+	mux.HandleFunc("POST /api/comments/{commentID}/hide", cfg.handlerCommentHide)
+	mux.HandleFunc("POST /api/comments/{commentID}/unhide", cfg.handlerCommentUnhide)
+
+	mux.HandleFunc("GET /api/videos/{videoID}/reactions", cfg.handlerReactionsGet)
+	mux.HandleFunc("PUT /api/videos/{videoID}/reactions/{reaction}", cfg.handlerReactionAdd)
+	mux.HandleFunc("DELETE /api/videos/{videoID}/reactions/{reaction}", cfg.handlerReactionDelete)
+	mux.HandleFunc("GET /api/liked_videos", cfg.handlerLikedVideosRetrieve)
+
+	mux.HandleFunc("POST /api/videos/{videoID}/tags", cfg.handlerVideoTagsAdd)
+	mux.HandleFunc("DELETE /api/videos/{videoID}/tags/{tag}", cfg.handlerVideoTagDelete)
+	mux.HandleFunc("GET /api/tags", cfg.handlerTagsRetrieve)
+
+	mux.HandleFunc("POST /api/playlists", cfg.handlerPlaylistCreate)
+	mux.HandleFunc("GET /api/playlists", cfg.handlerPlaylistsRetrieve)
+	mux.HandleFunc("GET /api/playlists/{playlistID}", cfg.handlerPlaylistGet)
+	mux.HandleFunc("PATCH /api/playlists/{playlistID}", cfg.handlerPlaylistUpdate)
+	mux.HandleFunc("DELETE /api/playlists/{playlistID}", cfg.handlerPlaylistDelete)
+	mux.HandleFunc("POST /api/playlists/{playlistID}/items", cfg.handlerPlaylistItemAdd)
+	mux.HandleFunc("POST /api/playlists/{playlistID}/items/{itemID}/move", cfg.handlerPlaylistItemMove)
+	mux.HandleFunc("DELETE /api/playlists/{playlistID}/items/{itemID}", cfg.handlerPlaylistItemDelete)
+
+	mux.HandleFunc("POST /api/videos/{videoID}/share_links", cfg.handlerShareLinkCreate)
+	mux.HandleFunc("GET /api/videos/{videoID}/share_links", cfg.handlerShareLinksRetrieve)
+	mux.HandleFunc("DELETE /api/share_links/{token}", cfg.handlerShareLinkDelete)
+	mux.HandleFunc("POST /api/share/{token}", cfg.handlerShareLinkResolve)
 
 	mux.HandleFunc("POST /admin/reset", cfg.handlerReset)
 
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"time"
+
+	"github.com/venzy/learn-file-storage-s3-golang/internal/media"
+)
+
+// Probes only read headers and indexes, so shouldn't take long
+const probeTimeout = time.Minute
+
+// ffmpeg runs an ffmpeg job that writes its output to a file.
+func (cfg *apiConfig) ffmpeg(ctx context.Context, args ...string) error {
+	_, err := cfg.media.Run(ctx, media.Job{Tool: media.FFmpeg, Args: args})
+	return err
+}
+
+// ffmpegWithProgress runs an ffmpeg job like ffmpeg, passing its progress
+// through media duration seconds long to report.
+func (cfg *apiConfig) ffmpegWithProgress(ctx context.Context, report func(media.Progress), duration float64, args ...string) error {
+	_, err := cfg.media.Run(ctx, media.Job{Tool: media.FFmpeg, Args: args, Progress: report, Duration: duration})
+	return err
+}
+
+// ffprobe runs an ffprobe job and returns its standard output.
+func (cfg *apiConfig) ffprobe(ctx context.Context, args ...string) ([]byte, error) {
+	stdout := bytes.Buffer{}
+	_, err := cfg.media.Run(ctx, media.Job{Tool: media.FFprobe, Args: args, Stdout: &stdout, Timeout: probeTimeout})
+	if err != nil {
+		return nil, err
+	}
+	return stdout.Bytes(), nil
+}
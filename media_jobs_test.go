@@ -0,0 +1,40 @@
+package main
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/venzy/learn-file-storage-s3-golang/internal/media"
+)
+
+// fakeMediaConfig returns a config whose ffmpeg and ffprobe jobs are handled
+// by handle instead of being run.
+func fakeMediaConfig(handle func(job media.Job) (stdout, stderr []byte, err error)) (*apiConfig, *media.FakeRunner) {
+	runner := &media.FakeRunner{Handle: handle}
+	return &apiConfig{media: runner, clock: systemClock{}}, runner
+}
+
+// hasArgs reports whether args contains want as a contiguous run.
+func hasArgs(args []string, want ...string) bool {
+	for i := range args {
+		if len(args)-i >= len(want) && slices.Equal(args[i:i+len(want)], want) {
+			return true
+		}
+	}
+	return false
+}
+
+// argAfter returns the argument following flag, or "" if there isn't one.
+func argAfter(args []string, flag string) string {
+	i := slices.Index(args, flag)
+	if i < 0 || i+1 >= len(args) {
+		return ""
+	}
+	return args[i+1]
+}
+
+// probeOutput is ffprobe's -show_streams JSON for the given streams, each
+// written as a JSON object's fields.
+func probeOutput(streams ...string) []byte {
+	return []byte(`{"streams":[{` + strings.Join(streams, `},{`) + `}]}`)
+}
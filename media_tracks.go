@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/venzy/learn-file-storage-s3-golang/internal/captions"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/database"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/media"
+)
+
+// Subtitle codecs ffmpeg can convert to WebVTT. Bitmap formats such as PGS
+// and DVD subtitles would need OCR, so they're skipped.
+var textSubtitleCodecs = map[string]bool{
+	"subrip":   true,
+	"srt":      true,
+	"mov_text": true,
+	"ass":      true,
+	"ssa":      true,
+	"webvtt":   true,
+	"text":     true,
+}
+
+type probeStream struct {
+	Index     int    `json:"index"`
+	CodecType string `json:"codec_type"`
+	CodecName string `json:"codec_name"`
+	Width     int    `json:"width"`
+	Height    int    `json:"height"`
+	Channels  int    `json:"channels"`
+	Tags      struct {
+		Language string `json:"language"`
+		Title    string `json:"title"`
+	} `json:"tags"`
+	Disposition struct {
+		Default int `json:"default"`
+	} `json:"disposition"`
+}
+
+func (cfg *apiConfig) probeStreams(ctx context.Context, filePath string) ([]probeStream, error) {
+	output, err := cfg.ffprobe(ctx, "-v", "error", "-print_format", "json", "-show_streams", filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	var ffprobeResult struct {
+		Streams []probeStream `json:"streams"`
+	}
+	err = json.Unmarshal(output, &ffprobeResult)
+	if err != nil {
+		return nil, fmt.Errorf("json unmarshal error: %v", err)
+	}
+	return ffprobeResult.Streams, nil
+}
+
+// streamLanguage returns the stream's language tag, or "und" (undetermined)
+// if it doesn't have a usable one.
+func streamLanguage(stream probeStream) string {
+	language := strings.ToLower(stream.Tags.Language)
+	if !captionLanguagePattern.MatchString(language) {
+		return "und"
+	}
+	return language
+}
+
+func (cfg *apiConfig) extractSubtitleStream(ctx context.Context, filePath string, streamIndex int) ([]byte, error) {
+	resultBuffer := bytes.Buffer{}
+	_, err := cfg.media.Run(ctx, media.Job{
+		Tool:   media.FFmpeg,
+		Args:   []string{"-v", "error", "-i", filePath, "-map", "0:" + strconv.Itoa(streamIndex), "-f", "webvtt", "-"},
+		Stdout: &resultBuffer,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resultBuffer.Bytes(), nil
+}
+
+// extractEmbeddedTracks records the audio streams of a new version's media
+// and turns its text subtitle streams into caption tracks for the version.
+// A subtitle stream that can't be extracted is logged and skipped rather than
+// failing the upload.
+func (cfg *apiConfig) extractEmbeddedTracks(ctx context.Context, version database.VideoVersion, sourcePath string) error {
+	streams, err := cfg.probeStreams(ctx, sourcePath)
+	if err != nil {
+		return err
+	}
+
+	extracted := map[string]bool{}
+
+	audioTracks := []database.AudioTrack{}
+	captionTracks := []database.CaptionTrack{}
+	for _, stream := range streams {
+		language := streamLanguage(stream)
+		label := stream.Tags.Title
+		if label == "" {
+			label = language
+		}
+
+		switch stream.CodecType {
+		case "audio":
+			audioTracks = append(audioTracks, database.AudioTrack{
+				Position: len(audioTracks),
+				Language: language,
+				Label:    label,
+				Codec:    stream.CodecName,
+				Channels: stream.Channels,
+				Default:  stream.Disposition.Default == 1,
+			})
+		case "subtitle":
+			if !textSubtitleCodecs[stream.CodecName] || extracted[language] {
+				continue
+			}
+			// Only one track per language; the first is usually the main one
+			extracted[language] = true
+
+			vtt, err := cfg.extractSubtitleStream(ctx, sourcePath, stream.Index)
+			if err == nil {
+				vtt, err = captions.ToWebVTT(vtt)
+			}
+			if err != nil {
+				log.Printf("Couldn't extract subtitle stream %d of video %s: %v", stream.Index, version.VideoID, err)
+				continue
+			}
+			key := randomStorageKey("captions/", ".vtt")
+			err = cfg.putObject(ctx, key, bytes.NewReader(vtt), "text/vtt")
+			if err != nil {
+				return err
+			}
+			captionTracks = append(captionTracks, database.CaptionTrack{
+				Language: language,
+				Label:    label,
+				URL:      cfg.storageURL(key),
+				Source:   database.CaptionSourceEmbedded,
+			})
+		}
+	}
+
+	err = cfg.db.SetVersionAudioTracks(version.ID, audioTracks)
+	if err != nil {
+		return err
+	}
+	return cfg.db.SetVersionCaptionTracks(version.ID, captionTracks)
+}
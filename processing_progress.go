@@ -0,0 +1,104 @@
+package main
+
+import (
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/database"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/media"
+)
+
+// Stages of processing that clients are told about
+const (
+	stageCutting             = "cutting"
+	stageTranscoding         = "transcoding"
+	stageMeasuringLoudness   = "measuring_loudness"
+	stageNormalizingLoudness = "normalizing_loudness"
+	stageWatermarking        = "watermarking"
+	stageDetectingChapters   = "detecting_chapters"
+	stageUploading           = "uploading"
+	stageGeneratingAssets    = "generating_assets"
+)
+
+// ffmpeg reports progress several times a second, which is more often than
+// it's worth writing to the database
+const progressSaveInterval = time.Second
+
+// processingJob records how far a run of processMedia has got, so clients
+// can follow along. A nil *processingJob records nothing, as progress is
+// only informational.
+type processingJob struct {
+	db    database.Client
+	clock clock
+	id    uuid.UUID
+
+	mu        sync.Mutex
+	stage     string
+	lastSaved time.Time
+	finished  bool
+}
+
+func (cfg *apiConfig) startProcessingJob(videoID uuid.UUID, stage string) *processingJob {
+	job, err := cfg.db.CreateProcessingJob(videoID, stage)
+	if err != nil {
+		log.Printf("Couldn't record processing job for video %s: %v", videoID, err)
+		return nil
+	}
+	return &processingJob{db: cfg.db, clock: cfg.clock, id: job.ID, stage: stage, lastSaved: cfg.clock.Now()}
+}
+
+// startStage moves the job on to a stage whose progress isn't known yet.
+func (j *processingJob) startStage(stage string) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	j.stage = stage
+	j.save(nil, nil)
+}
+
+// report records an ffmpeg job's progress through the current stage.
+func (j *processingJob) report(progress media.Progress) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if !progress.Done && j.clock.Now().Sub(j.lastSaved) < progressSaveInterval {
+		return
+	}
+	j.save(progress.Percent, progress.ETA)
+}
+
+func (j *processingJob) save(percent, etaSeconds *float64) {
+	j.lastSaved = j.clock.Now()
+	err := j.db.UpdateProcessingJobProgress(j.id, j.stage, percent, etaSeconds)
+	if err != nil {
+		log.Printf("Couldn't record progress of processing job %s: %v", j.id, err)
+	}
+}
+
+// finish records how the job ended. Only the first call counts, so callers
+// can fail a job that something they called may already have finished.
+func (j *processingJob) finish(succeeded bool) {
+	if j == nil {
+		return
+	}
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if j.finished {
+		return
+	}
+	j.finished = true
+	status := database.ProcessingJobFailed
+	if succeeded {
+		status = database.ProcessingJobSucceeded
+	}
+	err := j.db.FinishProcessingJob(j.id, status)
+	if err != nil {
+		log.Printf("Couldn't finish processing job %s: %v", j.id, err)
+	}
+}
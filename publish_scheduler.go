@@ -0,0 +1,33 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/venzy/learn-file-storage-s3-golang/internal/database"
+)
+
+// publishScheduler publishes videos whose publish_at has passed. Schedules
+// live in the database, so a restart only delays publishing until the first
+// run, which catches up on anything that fell due while the server was down.
+type publishScheduler struct {
+	db       database.Client
+	clock    clock
+	interval time.Duration
+}
+
+func (s *publishScheduler) Run(ctx context.Context) {
+	runEvery(ctx, s.interval, s.publishDue)
+}
+
+func (s *publishScheduler) publishDue(ctx context.Context) {
+	ids, err := s.db.PublishDueVideos(s.clock.Now())
+	if err != nil {
+		log.Printf("Couldn't publish scheduled videos: %v", err)
+		return
+	}
+	for _, id := range ids {
+		log.Printf("Published scheduled video %s", id)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/venzy/learn-file-storage-s3-golang/internal/database"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func TestPublishSchedulerPublishesDueVideos(t *testing.T) {
+	db, err := database.NewClient(filepath.Join(t.TempDir(), "tubely.db"))
+	if err != nil {
+		t.Fatalf("NewClient() error: %v", err)
+	}
+	user, err := db.CreateUser(database.CreateUserParams{Email: "owner@example.com", Password: "hash"})
+	if err != nil {
+		t.Fatalf("CreateUser() error: %v", err)
+	}
+	video, err := db.CreateVideo(database.CreateVideoParams{
+		Title:      "Launch",
+		Visibility: database.VisibilityPrivate,
+		UserID:     user.ID,
+	})
+	if err != nil {
+		t.Fatalf("CreateVideo() error: %v", err)
+	}
+
+	clock := &fakeClock{now: time.Date(2030, 1, 1, 9, 0, 0, 0, time.UTC)}
+	publishAt := clock.now.Add(time.Hour)
+	unlisted := database.VisibilityUnlisted
+	video.PublishAt = &publishAt
+	video.PublishVisibility = &unlisted
+	if err := db.UpdateVideo(video); err != nil {
+		t.Fatalf("UpdateVideo() error: %v", err)
+	}
+
+	scheduler := &publishScheduler{db: db, clock: clock, interval: time.Minute}
+
+	scheduler.publishDue(context.Background())
+	video, err = db.GetVideo(video.ID)
+	if err != nil {
+		t.Fatalf("GetVideo() error: %v", err)
+	}
+	if video.Visibility != database.VisibilityPrivate || video.PublishAt == nil {
+		t.Fatalf("before publish_at: visibility %s, publish_at %v; want still private and scheduled", video.Visibility, video.PublishAt)
+	}
+
+	clock.now = publishAt.Add(time.Second)
+	scheduler.publishDue(context.Background())
+	video, err = db.GetVideo(video.ID)
+	if err != nil {
+		t.Fatalf("GetVideo() error: %v", err)
+	}
+	if video.Visibility != database.VisibilityUnlisted {
+		t.Errorf("after publish_at: visibility = %s; want %s", video.Visibility, database.VisibilityUnlisted)
+	}
+	if video.PublishAt != nil || video.PublishVisibility != nil {
+		t.Errorf("after publish_at: schedule = %v, %v; want cleared", video.PublishAt, video.PublishVisibility)
+	}
+}
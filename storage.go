@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/venzy/learn-file-storage-s3-golang/internal/database"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// storageURL is where the object stored under key is served from.
+func (cfg *apiConfig) storageURL(key string) string {
+	return fmt.Sprintf("https://%s/%s", cfg.s3CfDistribution, key)
+}
+
+// storageKeyFromURL recovers the S3 object key from a URL previously built
+// against our CloudFront distribution.
+func (cfg *apiConfig) storageKeyFromURL(url string) (string, bool) {
+	prefix := fmt.Sprintf("https://%s/", cfg.s3CfDistribution)
+	if !strings.HasPrefix(url, prefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(url, prefix), true
+}
+
+// assetPathFromURL recovers the local path of a file served by our assets
+// file server, as thumbnails are.
+func (cfg *apiConfig) assetPathFromURL(url string) (string, bool) {
+	prefix := fmt.Sprintf("http://localhost:%s/assets/", cfg.port)
+	if !strings.HasPrefix(url, prefix) {
+		return "", false
+	}
+	name := strings.TrimPrefix(url, prefix)
+	if name == "" || path.Base(name) != name {
+		return "", false
+	}
+	return filepath.Join(cfg.assetsRoot, name), true
+}
+
+// deleteVideoBlobs removes the stored media a video refers to, including
+// that of every version. Media that's already gone isn't an error.
+func (cfg *apiConfig) deleteVideoBlobs(ctx context.Context, video database.Video) error {
+	keys := map[string]bool{}
+	if video.VideoURL != nil {
+		if key, ok := cfg.storageKeyFromURL(*video.VideoURL); ok {
+			keys[key] = true
+		}
+	}
+	versions, err := cfg.db.GetVideoVersions(video.ID)
+	if err != nil {
+		return err
+	}
+	for _, version := range versions {
+		keys[version.StorageKey] = true
+	}
+	assetURLs, err := cfg.db.GetVideoAssetURLs(video.ID)
+	if err != nil {
+		return err
+	}
+	for _, url := range assetURLs {
+		if key, ok := cfg.storageKeyFromURL(url); ok {
+			keys[key] = true
+		}
+	}
+	for _, track := range video.Captions {
+		if key, ok := cfg.storageKeyFromURL(track.URL); ok {
+			keys[key] = true
+		}
+	}
+	for _, chapter := range video.Chapters {
+		if chapter.ThumbnailURL == nil {
+			continue
+		}
+		if key, ok := cfg.storageKeyFromURL(*chapter.ThumbnailURL); ok {
+			keys[key] = true
+		}
+	}
+	for key := range keys {
+		err := cfg.deleteObject(ctx, key)
+		if err != nil {
+			return err
+		}
+	}
+
+	if video.ThumbnailURL != nil {
+		if assetPath, ok := cfg.assetPathFromURL(*video.ThumbnailURL); ok {
+			err := os.Remove(assetPath)
+			if err != nil && !errors.Is(err, os.ErrNotExist) {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// randomStorageKey makes a unique key under prefix for a new object.
+func randomStorageKey(prefix, fileExtension string) string {
+	randBytes := make([]byte, 32)
+	// Guaranteed not to return an error on all but legacy Linux systems
+	rand.Read(randBytes)
+	return prefix + base64.RawURLEncoding.EncodeToString(randBytes) + fileExtension
+}
+
+func (cfg *apiConfig) putObject(ctx context.Context, key string, body io.Reader, contentType string) error {
+	_, err := cfg.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(cfg.s3Bucket),
+		Key:         aws.String(key),
+		Body:        body,
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't upload %s: %w", key, err)
+	}
+	return nil
+}
+
+// downloadObject copies the object stored under key into the file at
+// filePath.
+func (cfg *apiConfig) downloadObject(ctx context.Context, key, filePath string) error {
+	output, err := cfg.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(cfg.s3Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't download %s: %w", key, err)
+	}
+	defer output.Body.Close()
+
+	file, err := os.Create(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, output.Body)
+	if err != nil {
+		return fmt.Errorf("couldn't download %s: %w", key, err)
+	}
+	return file.Close()
+}
+
+func (cfg *apiConfig) deleteObject(ctx context.Context, key string) error {
+	_, err := cfg.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(cfg.s3Bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("couldn't delete %s: %w", key, err)
+	}
+	return nil
+}
+
+func generatePresignedURL(s3Client *s3.Client, bucket, key string, expireTime time.Duration) (string, error) {
+	presignClient := s3.NewPresignClient(s3Client)
+	request, err := presignClient.PresignGetObject(context.Background(), &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(expireTime))
+	if err != nil {
+		return "", fmt.Errorf("presign error: %v", err)
+	}
+	return request.URL, nil
+}
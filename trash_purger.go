@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// How long a trashed video can be restored for before it's purged
+const trashRetention = 30 * 24 * time.Hour
+
+// trashPurger permanently deletes videos, along with their stored media, once
+// they've been in the trash for longer than the retention period.
+type trashPurger struct {
+	cfg      *apiConfig
+	interval time.Duration
+}
+
+func (p *trashPurger) Run(ctx context.Context) {
+	runEvery(ctx, p.interval, p.purge)
+}
+
+func (p *trashPurger) purge(ctx context.Context) {
+	videos, err := p.cfg.db.GetVideosTrashedBefore(p.cfg.clock.Now().Add(-trashRetention))
+	if err != nil {
+		log.Printf("Couldn't list videos to purge: %v", err)
+		return
+	}
+
+	for _, video := range videos {
+		// Keep the row until the media is gone so a failure is retried on
+		// the next run rather than leaking blobs
+		err := p.cfg.deleteVideoBlobs(ctx, video)
+		if err != nil {
+			log.Printf("Couldn't delete media for video %s: %v", video.ID, err)
+			continue
+		}
+		err = p.cfg.db.DeleteVideo(video.ID)
+		if err != nil {
+			log.Printf("Couldn't purge video %s: %v", video.ID, err)
+			continue
+		}
+		log.Printf("Purged video %s from the trash", video.ID)
+	}
+}
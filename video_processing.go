@@ -0,0 +1,410 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/google/uuid"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/chapters"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/database"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/fileext"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/loudness"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/media"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/sprites"
+	"github.com/venzy/learn-file-storage-s3-golang/internal/watermark"
+)
+
+// processingOptions are per-upload choices about how media is processed.
+type processingOptions struct {
+	// Where the preview clip starts, in seconds; nil picks a point a little
+	// way in
+	PreviewStart *float64
+	// Overlaid on the video if set
+	Watermark *appliedWatermark
+	// Whether to bring the audio to a standard loudness
+	NormalizeLoudness bool
+}
+
+type appliedWatermark struct {
+	Config watermark.Config
+	// Local copy of the watermark PNG
+	ImagePath string
+}
+
+// parseProcessingOptions reads processingOptions from an upload's form.
+func parseProcessingOptions(r *http.Request) (processingOptions, error) {
+	options := processingOptions{}
+	if previewStartString := r.FormValue("preview_start"); previewStartString != "" {
+		previewStart, err := strconv.ParseFloat(previewStartString, 64)
+		if err != nil || previewStart < 0 {
+			return processingOptions{}, errors.New("preview_start must be a non-negative number of seconds")
+		}
+		options.PreviewStart = &previewStart
+	}
+	if normalizeString := r.FormValue("normalize_loudness"); normalizeString != "" {
+		normalize, err := strconv.ParseBool(normalizeString)
+		if err != nil {
+			return processingOptions{}, errors.New("normalize_loudness must be true or false")
+		}
+		options.NormalizeLoudness = normalize
+	}
+	return options, nil
+}
+
+// Videos are remuxed to MP4 for streaming, and audio to M4A
+const (
+	processedMediaType      = "video/mp4"
+	processedAudioMediaType = "audio/mp4"
+)
+
+// processMedia takes a media file through the whole pipeline: it's remuxed or
+// transcoded for streaming, probed, stored as a new version of the video
+// along with its embedded tracks and derived assets, and made the active
+// version. The video is marked as processing throughout. If anything goes
+// wrong it's marked failed, unless an earlier version is still active, in
+// which case it's ready again as that version still plays. Progress is
+// recorded on job, which is finished when processing ends.
+func (cfg *apiConfig) processMedia(ctx context.Context, job *processingJob, video database.Video, sourcePath string, kind database.MediaKind, uploaderID uuid.UUID, options processingOptions) (database.Video, error) {
+	job.startStage(stageTranscoding)
+	err := cfg.db.SetVideoStatus(video.ID, database.VideoStatusProcessing)
+	if err != nil {
+		job.finish(false)
+		return database.Video{}, err
+	}
+	succeeded := false
+	defer func() {
+		if !succeeded {
+			status := database.VideoStatusFailed
+			if video.ActiveVersionID != nil {
+				status = database.VideoStatusReady
+			}
+			cfg.db.SetVideoStatus(video.ID, status)
+		}
+		job.finish(succeeded)
+	}()
+
+	// The source's duration is only used to estimate progress, so it's fine
+	// not to know it
+	sourceDuration, _ := cfg.getVideoDuration(ctx, sourcePath)
+	var processedFilePath, mediaType string
+	if kind == database.MediaKindAudio {
+		processedFilePath, err = cfg.transcodeAudio(ctx, sourcePath, sourceDuration, job.report)
+		mediaType = processedAudioMediaType
+	} else {
+		processedFilePath, err = cfg.processVideoForFastStart(ctx, sourcePath, sourceDuration, job.report)
+		mediaType = processedMediaType
+	}
+	if err != nil {
+		return database.Video{}, err
+	}
+	defer os.Remove(processedFilePath)
+
+	// Videos are stored under a prefix based on their aspect ratio
+	var aspectClass *string
+	storagePrefix := "audio/"
+	if kind == database.MediaKindVideo {
+		aspectRatio, err := cfg.getVideoAspectRatio(ctx, processedFilePath)
+		if err != nil {
+			return database.Video{}, err
+		}
+		class := aspectClassFromRatio(aspectRatio)
+		aspectClass = &class
+		storagePrefix = class + "/"
+	}
+	duration, err := cfg.getVideoDuration(ctx, processedFilePath)
+	if err != nil {
+		return database.Video{}, err
+	}
+
+	var measurement *loudness.Measurement
+	if options.NormalizeLoudness {
+		normalizedFilePath, defaultMeasurement, err := cfg.normalizeLoudness(ctx, processedFilePath, loudness.Default, duration, job)
+		if err != nil {
+			return database.Video{}, err
+		}
+		if normalizedFilePath != "" {
+			defer os.Remove(normalizedFilePath)
+			processedFilePath = normalizedFilePath
+			measurement = defaultMeasurement
+		}
+	}
+
+	// The watermarked video is what gets streamed, but the owner can still
+	// download the original
+	originalFilePath := ""
+	if options.Watermark != nil {
+		job.startStage(stageWatermarking)
+		watermarkedFilePath, err := cfg.applyWatermark(ctx, processedFilePath, *options.Watermark, duration, job.report)
+		if err != nil {
+			return database.Video{}, err
+		}
+		defer os.Remove(watermarkedFilePath)
+		originalFilePath, processedFilePath = processedFilePath, watermarkedFilePath
+	}
+
+	// Chapters are carried in the file as well as served as WebVTT. Ones the
+	// owner has set are kept; otherwise videos get some proposed from their
+	// scene changes
+	embeddedChapters := ownerChapters(video)
+	var proposedChapters []chapters.Chapter
+	if len(embeddedChapters) == 0 && kind == database.MediaKindVideo {
+		job.startStage(stageDetectingChapters)
+		proposedChapters, err = cfg.detectChapters(ctx, processedFilePath, duration, job.report)
+		if err != nil {
+			log.Printf("Couldn't detect chapters for video %s: %v", video.ID, err)
+		}
+		embeddedChapters = proposedChapters
+	}
+	if len(embeddedChapters) > 0 {
+		chapteredFilePath, err := cfg.embedChapters(ctx, processedFilePath, embeddedChapters, duration)
+		if err != nil {
+			return database.Video{}, err
+		}
+		defer os.Remove(chapteredFilePath)
+		processedFilePath = chapteredFilePath
+	}
+
+	fileExtension := fileext.FromMediaType(mediaType)
+	fileName := randomStorageKey(storagePrefix, fileExtension)
+
+	job.startStage(stageUploading)
+	processedFile, err := os.Open(processedFilePath)
+	if err != nil {
+		return database.Video{}, err
+	}
+	defer processedFile.Close()
+
+	err = cfg.putObject(ctx, fileName, processedFile, mediaType)
+	if err != nil {
+		return database.Video{}, err
+	}
+
+	processedInfo, err := processedFile.Stat()
+	if err != nil {
+		return database.Video{}, err
+	}
+
+	// Keep earlier uploads as older versions rather than replacing them
+	versionParams := database.CreateVideoVersionParams{
+		VideoID:     video.ID,
+		StorageKey:  fileName,
+		MediaKind:   kind,
+		Duration:    &duration,
+		AspectClass: aspectClass,
+		SizeBytes:   processedInfo.Size(),
+		UploadedBy:  uploaderID,
+	}
+	if measurement != nil {
+		versionParams.IntegratedLoudness = &measurement.Integrated
+		versionParams.TruePeak = &measurement.TruePeak
+	}
+	version, err := cfg.db.CreateVideoVersion(versionParams)
+	if err != nil {
+		return database.Video{}, err
+	}
+
+	// Subtitles aren't carried over into the processed file, so look for
+	// them in the original. The tracks belong to the version, so they only
+	// show once it's activated.
+	err = cfg.extractEmbeddedTracks(ctx, version, sourcePath)
+	if err != nil {
+		return database.Video{}, err
+	}
+	if originalFilePath != "" {
+		originalFile, err := os.Open(originalFilePath)
+		if err != nil {
+			return database.Video{}, err
+		}
+		defer originalFile.Close()
+		_, err = cfg.storeVersionAsset(ctx, version, database.AssetOriginal, originalFile, "originals/", fileExtension, mediaType)
+		if err != nil {
+			return database.Video{}, err
+		}
+	}
+	job.startStage(stageGeneratingAssets)
+	cfg.generateVersionAssets(ctx, version, processedFilePath, options)
+
+	err = cfg.db.ActivateVideoVersion(version, cfg.storageURL(fileName))
+	if err != nil {
+		return database.Video{}, err
+	}
+	succeeded = true
+
+	// Chapters belong to the video rather than the version, so the detected
+	// ones only replace the old ones once the new version is live
+	if proposedChapters != nil {
+		err = cfg.storeDetectedChapters(ctx, video.ID, processedFilePath, proposedChapters)
+		if err != nil {
+			log.Printf("Couldn't store chapters for video %s: %v", video.ID, err)
+		}
+	}
+
+	video, err = cfg.db.GetVideo(video.ID)
+	if err != nil {
+		return database.Video{}, err
+	}
+	return cfg.syncWaveformThumbnail(video)
+}
+
+// applyWatermark re-encodes the video with the watermark overlaid, keeping
+// its audio as it is.
+func (cfg *apiConfig) applyWatermark(ctx context.Context, filePath string, applied appliedWatermark, duration float64, report func(media.Progress)) (string, error) {
+	outputFilePath := filePath + ".watermarked"
+	err := cfg.ffmpegWithProgress(ctx, report, duration, "-v", "error",
+		"-i", filePath,
+		"-i", applied.ImagePath,
+		"-filter_complex", applied.Config.FilterComplex(),
+		"-map", "[out]", "-map", "0:a?",
+		"-c:v", "libx264", "-preset", "veryfast", "-crf", "20", "-pix_fmt", "yuv420p",
+		"-c:a", "copy",
+		"-movflags", "faststart",
+		"-f", "mp4", "-y", outputFilePath)
+	if err != nil {
+		return "", err
+	}
+	return outputFilePath, nil
+}
+
+// generateVersionAssets derives the optional extras for a newly uploaded
+// version from its processed media. They're nice to have rather than
+// essential, so a failure is logged and doesn't fail the upload.
+func (cfg *apiConfig) generateVersionAssets(ctx context.Context, version database.VideoVersion, mediaPath string, options processingOptions) {
+	if version.Duration == nil {
+		return
+	}
+
+	err := cfg.generatePeaks(ctx, version, mediaPath)
+	if err != nil {
+		log.Printf("Couldn't generate peaks for video %s: %v", version.VideoID, err)
+	}
+
+	if version.MediaKind == database.MediaKindAudio {
+		err := cfg.generateWaveform(ctx, version, mediaPath)
+		if err != nil {
+			log.Printf("Couldn't generate waveform for video %s: %v", version.VideoID, err)
+		}
+		return
+	}
+
+	err = cfg.generateSprites(ctx, version, mediaPath)
+	if err != nil {
+		log.Printf("Couldn't generate preview sprites for video %s: %v", version.VideoID, err)
+	}
+
+	if cfg.previewClipLength > 0 {
+		err = cfg.generatePreviewClips(ctx, version, mediaPath, options.PreviewStart)
+		if err != nil {
+			log.Printf("Couldn't generate preview clips for video %s: %v", version.VideoID, err)
+		}
+	}
+}
+
+// generateSprites renders a sprite sheet of frames for scrubbing previews and
+// a WebVTT thumbnails track that points into it.
+func (cfg *apiConfig) generateSprites(ctx context.Context, version database.VideoVersion, mediaPath string) error {
+	width, height := 0, 0
+	streams, err := cfg.probeStreams(ctx, mediaPath)
+	if err != nil {
+		return err
+	}
+	for _, stream := range streams {
+		if stream.CodecType == "video" {
+			width, height = stream.Width, stream.Height
+			break
+		}
+	}
+
+	sheet := sprites.NewSheet(*version.Duration, width, height)
+	spritePath := mediaPath + ".sprite.jpg"
+	err = cfg.ffmpeg(ctx, "-v", "error", "-i", mediaPath, "-vf", sheet.FFmpegFilter(), "-frames:v", "1", "-q:v", "5", "-y", spritePath)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(spritePath)
+
+	spriteFile, err := os.Open(spritePath)
+	if err != nil {
+		return err
+	}
+	defer spriteFile.Close()
+
+	spriteURL, err := cfg.storeVersionAsset(ctx, version, database.AssetSprite, spriteFile, "sprites/", ".jpg", "image/jpeg")
+	if err != nil {
+		return err
+	}
+	vtt := sheet.WebVTT(spriteURL, *version.Duration)
+	_, err = cfg.storeVersionAsset(ctx, version, database.AssetThumbnailsVTT, bytes.NewReader(vtt), "sprites/", ".vtt", "text/vtt")
+	return err
+}
+
+// previewSegment picks the part of a video of the given duration to make a
+// preview clip of, keeping it within the video.
+func previewSegment(duration, clipLength float64, start *float64) (float64, float64) {
+	length := min(clipLength, duration)
+	// Openings are often titles or black, so by default start a little in
+	from := duration * 0.1
+	if start != nil {
+		from = *start
+	}
+	return max(0, min(from, duration-length)), length
+}
+
+// generatePreviewClips makes a short silent looping preview of a segment of
+// the video, as both an animated WebP and a small MP4.
+func (cfg *apiConfig) generatePreviewClips(ctx context.Context, version database.VideoVersion, mediaPath string, start *float64) error {
+	from, length := previewSegment(*version.Duration, cfg.previewClipLength, start)
+	segment := []string{"-v", "error", "-ss", strconv.FormatFloat(from, 'f', 3, 64), "-t", strconv.FormatFloat(length, 'f', 3, 64), "-i", mediaPath, "-an"}
+
+	clips := []struct {
+		kind          database.AssetKind
+		fileExtension string
+		contentType   string
+		args          []string
+	}{
+		{database.AssetPreviewWebP, ".webp", "image/webp", []string{"-vf", "fps=12,scale=320:-2", "-c:v", "libwebp", "-loop", "0", "-q:v", "60"}},
+		{database.AssetPreviewMP4, ".mp4", "video/mp4", []string{"-vf", "scale=320:-2", "-c:v", "libx264", "-preset", "veryfast", "-crf", "30", "-pix_fmt", "yuv420p", "-movflags", "faststart"}},
+	}
+	for _, clip := range clips {
+		outputPath := mediaPath + ".preview" + clip.fileExtension
+		args := append(append(append([]string{}, segment...), clip.args...), "-y", outputPath)
+		err := cfg.ffmpeg(ctx, args...)
+		if err != nil {
+			return err
+		}
+		defer os.Remove(outputPath)
+
+		clipFile, err := os.Open(outputPath)
+		if err != nil {
+			return err
+		}
+		defer clipFile.Close()
+
+		_, err = cfg.storeVersionAsset(ctx, version, clip.kind, clipFile, "previews/", clip.fileExtension, clip.contentType)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// storeVersionAsset uploads a derived file under prefix and records it
+// against the version, returning its URL.
+func (cfg *apiConfig) storeVersionAsset(ctx context.Context, version database.VideoVersion, kind database.AssetKind, body io.Reader, prefix, fileExtension, contentType string) (string, error) {
+	key := randomStorageKey(prefix, fileExtension)
+	err := cfg.putObject(ctx, key, body, contentType)
+	if err != nil {
+		return "", err
+	}
+	url := cfg.storageURL(key)
+	err = cfg.db.SetVersionAsset(version.ID, kind, url)
+	if err != nil {
+		return "", err
+	}
+	return url, nil
+}